@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -9,6 +10,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/hellofresh/stats-go"
 	"github.com/hellofresh/stats-go/bucket"
@@ -17,8 +19,11 @@ import (
 	statsLogger "github.com/hellofresh/stats-go/log"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/hellofresh/kandalf/pkg/admin"
 	"github.com/hellofresh/kandalf/pkg/amqp"
 	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/health"
+	"github.com/hellofresh/kandalf/pkg/kafka"
 	"github.com/hellofresh/kandalf/pkg/producer"
 	"github.com/hellofresh/kandalf/pkg/storage"
 	"github.com/hellofresh/kandalf/pkg/workers"
@@ -59,48 +64,207 @@ func RunApp(ctx context.Context, version, configPath string) error {
 		return fmt.Errorf("failed to load pipes config: %w", err)
 	}
 
-	persistentStorage, err := storage.NewPersistentStorage(storageURL)
+	kafkaDestinations, err := globalConfig.KafkaDestinations()
 	if err != nil {
-		return fmt.Errorf("failed to establish Redis connection: %w", err)
+		return fmt.Errorf("failed to load Kafka clusters config: %w", err)
+	}
+
+	pipesByDestination, err := config.PipesByDestination(config.FilterPipes(pipesList, config.PipeKindRabbitToKafka), kafkaDestinations)
+	if err != nil {
+		return fmt.Errorf("failed to load pipes config: %w", err)
+	}
+
+	pipesByKafkaSource, err := config.PipesByDestination(config.FilterPipes(pipesList, config.PipeKindKafkaToRabbit), kafkaDestinations)
+	if err != nil {
+		return fmt.Errorf("failed to load pipes config: %w", err)
+	}
+
+	rabbitSources, err := globalConfig.RabbitSources()
+	if err != nil {
+		return fmt.Errorf("failed to load RabbitMQ connections config: %w", err)
 	}
-	// Do not close storage here as it is required in Worker close to store unhandled messages
 
-	kafkaProducer, err := producer.NewKafkaProducer(globalConfig.Kafka, statsClient)
+	pipesByConnection, err := config.PipesByConnection(pipesList, rabbitSources)
 	if err != nil {
-		return fmt.Errorf("failed to establish Kafka connection: %w", err)
+		return fmt.Errorf("failed to load pipes config: %w", err)
 	}
+
+	// workers keep running until they are shut down, so messages consumed during shutdown are still published
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	checker := health.NewChecker()
+	bridgeWorkers := make(map[string]*workers.BridgeWorker, len(kafkaDestinations))
+	amqpConsumers := make([]*amqp.Consumer, 0, len(rabbitSources))
+	amqpConnections := make(map[string]*amqp.Connection, len(rabbitSources))
 	defer func() {
-		if err := kafkaProducer.Close(); err != nil {
-			log.WithError(err).Error("Got error on closing kafka producer")
-		}
+		shutdown(globalConfig.Worker.ShutdownTimeout, amqpConsumers, bridgeWorkers, amqpConnections)
 	}()
 
-	worker, err := workers.NewBridgeWorker(globalConfig.Worker, persistentStorage, kafkaProducer, statsClient)
-	defer func() {
-		if err := worker.Close(); err != nil {
-			log.WithError(err).Error("Got error on closing persistent storage")
+	for _, destination := range kafkaDestinations {
+		if len(pipesByDestination[destination.Name]) == 0 {
+			log.WithField("cluster", destination.Name).Debug("No pipes publish messages to Kafka cluster, skipping its producer")
+			continue
 		}
-	}()
 
-	queuesHandler := amqp.NewQueuesHandler(pipesList, worker.MessageHandler, statsClient)
-	amqpConnection, err := amqp.NewConnection(globalConfig.RabbitDSN, queuesHandler)
-	if err != nil {
-		return fmt.Errorf("failed to establish initial connection to AMQP: %w", err)
+		kafkaProducer, err := producer.NewKafkaProducer(destination.Kafka, statsClient)
+		if err != nil {
+			return fmt.Errorf("failed to establish Kafka %q connection: %w", destination.Name, err)
+		}
+
+		// worker closes its producer on shutdown
+		worker, err := newBridgeWorker(globalConfig.Worker, storageURL, destination.Name, kafkaProducer, statsClient)
+		if err != nil {
+			closeProducer(kafkaProducer, destination.Name)
+			return err
+		}
+
+		bridgeWorkers[destination.Name] = worker
+		addWorkerChecks(checker, destination.Name, worker)
+
+		kafkaCheck, err := kafka.NewHealthCheck(destination.Kafka, config.PipesTopics(pipesByDestination[destination.Name]))
+		if err != nil {
+			return fmt.Errorf("failed to establish Kafka %q connection: %w", destination.Name, err)
+		}
+		defer func(name string) {
+			if err := kafkaCheck.Close(); err != nil {
+				log.WithError(err).WithField("cluster", name).Error("Got error on closing kafka health check")
+			}
+		}(destination.Name)
+		checker.Add("kafka."+destination.Name, kafkaCheck.Health)
 	}
-	defer func() {
-		if err := amqpConnection.Close(); err != nil {
-			log.WithError(err).Error("Got error on closing AMQP connection")
+
+	if len(pipesByDestination[config.HTTPDestination]) > 0 {
+		httpProducer, err := producer.NewHTTPProducer(globalConfig.HTTP, statsClient)
+		if err != nil {
+			return fmt.Errorf("failed to configure HTTP producer: %w", err)
 		}
-	}()
 
-	ctx, cancel := context.WithCancel(ctx)
+		worker, err := newBridgeWorker(globalConfig.Worker, storageURL, config.HTTPDestination, httpProducer, statsClient)
+		if err != nil {
+			closeProducer(httpProducer, config.HTTPDestination)
+			return err
+		}
+
+		bridgeWorkers[config.HTTPDestination] = worker
+		addWorkerChecks(checker, config.HTTPDestination, worker)
+	}
+	dispatcher := workers.NewDispatcher(bridgeWorkers)
+
+	amqpState := make(chan amqp.State, len(rabbitSources))
+	amqpPublishers := make(map[string]*amqp.Publisher, len(rabbitSources))
+	for _, source := range rabbitSources {
+		sourcePipes := pipesByConnection[source.Name]
+		if len(sourcePipes) == 0 {
+			log.WithField("connection", source.Name).Warn("No pipes use AMQP connection, skipping it")
+			continue
+		}
+
+		var initHandlers []amqp.InitQueuesHandler
+		if consumerPipes := config.FilterPipes(sourcePipes, config.PipeKindRabbitToKafka); len(consumerPipes) > 0 {
+			consumer := amqp.NewConsumer(consumerPipes, source.Rabbit, dispatcher.MessageHandler, statsClient)
+			initHandlers = append(initHandlers, consumer.Init)
+			amqpConsumers = append(amqpConsumers, consumer)
+			checker.Add("amqp-consumer."+source.Name, consumer.Health)
+		}
+		if publisherPipes := config.FilterPipes(sourcePipes, config.PipeKindKafkaToRabbit); len(publisherPipes) > 0 {
+			publisher := amqp.NewPublisher(publisherPipes, source.Rabbit, statsClient)
+			initHandlers = append(initHandlers, publisher.Init)
+			amqpPublishers[source.Name] = publisher
+		}
+
+		amqpConnection, err := amqp.NewConnection(source.DSN, source.Rabbit, amqp.ChainInitQueuesHandlers(initHandlers...), statsClient)
+		if err != nil {
+			return fmt.Errorf("failed to establish initial connection to AMQP %q: %w", source.Name, err)
+		}
+		amqpConnections[source.Name] = amqpConnection
+		checker.Add("amqp."+source.Name, amqpConnection.Health)
+
+		amqpConnection.NotifyState(amqpState)
+	}
+
+	var kafkaConsumers []*kafka.Consumer
+	for _, source := range kafkaDestinations {
+		for _, pipe := range pipesByKafkaSource[source.Name] {
+			kafkaConsumer, err := kafka.NewConsumer(source.Kafka, pipe, amqpPublishers[pipe.Connection()], statsClient)
+			if err != nil {
+				return fmt.Errorf("failed to join Kafka %q consumer group %q: %w", source.Name, pipe.ConsumerGroup(), err)
+			}
+			defer func(topic string) {
+				if err := kafkaConsumer.Close(); err != nil {
+					log.WithError(err).WithField("topic", topic).Error("Got error on closing kafka consumer")
+				}
+			}(pipe.KafkaTopic)
+
+			kafkaConsumers = append(kafkaConsumers, kafkaConsumer)
+		}
+	}
+
+	go startMetricsServer(statsClient, checker, newAdminAPI(globalConfig.Admin, pipesList, amqpConsumers, bridgeWorkers), globalConfig.Stats.Port)
+	for _, worker := range bridgeWorkers {
+		worker.Go(ctx)
+	}
+	for _, kafkaConsumer := range kafkaConsumers {
+		kafkaConsumer.Go(ctx)
+	}
+
+	return waitProcessShutdown(amqpState)
+}
+
+// shutdown stops the application in order, so consumed messages are not lost: bridge workers stop applying
+// backpressure, so AMQP consumers blocked by it are released, and AMQP consumers are cancelled, then bridge workers
+// wait for in-flight messages, store the ones left in memory and close producers and storages.
+// AMQP connections are closed last, as consumed messages are acknowledged using them.
+func shutdown(timeout time.Duration, consumers []*amqp.Consumer, bridgeWorkers map[string]*workers.BridgeWorker, connections map[string]*amqp.Connection) {
+	log.WithField("timeout", timeout).Info("Kandalf shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	go startMetricsServer(statsClient, globalConfig.Stats.Port)
-	worker.Go(ctx)
-	waitProcessShutdown()
+	for _, worker := range bridgeWorkers {
+		worker.StopAdmission()
+	}
+
+	for _, consumer := range consumers {
+		if err := consumer.Stop(ctx); err != nil {
+			log.WithError(err).Error("Got error on stopping AMQP consumer, messages being handled are requeued")
+		}
+	}
+
+	for name, worker := range bridgeWorkers {
+		if err := worker.Shutdown(ctx); err != nil {
+			log.WithError(err).WithField("destination", name).Error("Got error on shutting down bridge worker")
+		}
+	}
+
+	for name, connection := range connections {
+		if err := connection.Close(); err != nil {
+			log.WithError(err).WithField("connection", name).Error("Got error on closing AMQP connection")
+		}
+	}
+}
+
+func closeProducer(p producer.Producer, destination string) {
+	if err := p.Close(); err != nil {
+		log.WithError(err).WithField("destination", destination).Error("Got error on closing producer")
+	}
+}
+
+// newBridgeWorker creates bridge worker for the destination, every destination has its own storage,
+// so messages are replayed to the destination they failed to be published to
+func newBridgeWorker(workerConfig config.WorkerConfig, storageURL *url.URL, destination string, p producer.Producer, statsClient client.Client) (*workers.BridgeWorker, error) {
+	destinationStorageURL := storageURL
+	if destination != config.DefaultKafkaCluster {
+		destinationStorageURL = storage.NamespacedDSN(storageURL, destination)
+	}
 
-	return nil
+	// Do not close storage here as it is required in Worker close to store unhandled messages
+	persistentStorage, err := storage.NewPersistentStorage(destinationStorageURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q persistent storage: %w", destinationStorageURL.Scheme, err)
+	}
+
+	return workers.NewBridgeWorker(workerConfig, persistentStorage, p, statsClient)
 }
 
 func initStatsClient(config config.StatsConfig) (client.Client, error) {
@@ -131,14 +295,46 @@ func initStatsClient(config config.StatsConfig) (client.Client, error) {
 	return statsClient, nil
 }
 
-func startMetricsServer(sc client.Client, port int) {
+// addWorkerChecks registers health checks of bridge worker cache and storage
+func addWorkerChecks(checker *health.Checker, destination string, worker *workers.BridgeWorker) {
+	checker.Add("cache."+destination, worker.CacheHealth)
+	checker.Add("storage."+destination, worker.StorageHealth)
+}
+
+// newAdminAPI creates admin API for pipes consumers and bridge workers, nil is returned if admin token is not set
+func newAdminAPI(adminConfig config.AdminConfig, pipes []config.Pipe, consumers []*amqp.Consumer, bridgeWorkers map[string]*workers.BridgeWorker) *admin.API {
+	if adminConfig.Token == "" {
+		log.Info("Admin token is not set, admin API is disabled")
+		return nil
+	}
+
+	pipeConsumers := make([]admin.PipeConsumer, 0, len(consumers))
+	for _, consumer := range consumers {
+		pipeConsumers = append(pipeConsumers, consumer)
+	}
+
+	adminWorkers := make(map[string]admin.Worker, len(bridgeWorkers))
+	for destination, worker := range bridgeWorkers {
+		adminWorkers[destination] = worker
+	}
+
+	return admin.NewAPI(adminConfig.Token, pipes, pipeConsumers, adminWorkers)
+}
+
+func startMetricsServer(sc client.Client, checker *health.Checker, adminAPI *admin.API, port int) {
 	http.Handle("/metrics", sc.Handler())
+	http.Handle("/healthz", checker.LivenessHandler())
+	http.Handle("/readyz", checker.ReadinessHandler())
+	if adminAPI != nil {
+		http.Handle("/admin/", adminAPI.Handler())
+	}
 	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
 		log.WithError(err).Error("Got an error from metrics http server")
 	}
 }
 
-func waitProcessShutdown() {
+// waitProcessShutdown waits for termination signal or AMQP connection to fail
+func waitProcessShutdown(amqpState <-chan amqp.State) error {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt,
 		syscall.SIGHUP,
@@ -148,7 +344,15 @@ func waitProcessShutdown() {
 	)
 
 	log.Infof("[*] Waiting for users. To exit press CTRL+C")
-	sig := <-sigChan
-
-	log.WithFields(log.Fields{"sig": sig}).Info("Received sig")
+	for {
+		select {
+		case sig := <-sigChan:
+			log.WithFields(log.Fields{"sig": sig}).Info("Received sig")
+			return nil
+		case state := <-amqpState:
+			if state == amqp.StateFailed {
+				return errors.New("failed to re-establish connection to AMQP")
+			}
+		}
+	}
 }
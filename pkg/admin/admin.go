@@ -0,0 +1,233 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hellofresh/kandalf/pkg/amqp"
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/workers"
+)
+
+const (
+	actionPause  = "pause"
+	actionResume = "resume"
+)
+
+// PipeConsumer pauses and resumes consumption of "rabbit-to-kafka" pipes, see amqp.Consumer
+type PipeConsumer interface {
+	Pipes() map[string]amqp.PipeState
+	Pause(queue string) error
+	Resume(queue string) error
+}
+
+// Worker flushes buffers and replays stored messages of a single destination, see workers.BridgeWorker
+type Worker interface {
+	Buffers() map[string]workers.BufferState
+	Flush()
+	Replay()
+}
+
+// PipeStats is a live state of the pipe
+type PipeStats struct {
+	Kind         string   `json:"kind"`
+	Connection   string   `json:"connection"`
+	Queue        string   `json:"queue,omitempty"`
+	Topic        string   `json:"topic,omitempty"`
+	URL          string   `json:"url,omitempty"`
+	Destinations []string `json:"destinations,omitempty"`
+	Consumers    int      `json:"consumers"`
+	Paused       bool     `json:"paused"`
+	// Buffers is a state of the buffer pipe messages are published from by destination name
+	Buffers map[string]workers.BufferState `json:"buffers,omitempty"`
+}
+
+// API is an HTTP API for operating running application, all the requests must be authorised with bearer token
+type API struct {
+	token     []byte
+	pipes     []config.Pipe
+	consumers []PipeConsumer
+	workers   map[string]Worker
+}
+
+// NewAPI instantiates new admin API for given pipes, consumers of "rabbit-to-kafka" pipes
+// and bridge workers by destination name
+func NewAPI(token string, pipes []config.Pipe, consumers []PipeConsumer, workers map[string]Worker) *API {
+	return &API{token: []byte(token), pipes: pipes, consumers: consumers, workers: workers}
+}
+
+// Handler returns HTTP handler serving admin API under "/admin/" path:
+//
+//	GET /admin/pipes - list pipes and their live stats
+//	POST /admin/pipes/<queue>/pause - pause consumption of the pipe with given queue name
+//	POST /admin/pipes/<queue>/resume - resume consumption of the pipe with given queue name
+//	POST /admin/flush[?destination=<name>] - flush buffers of all the workers or of the given destination worker
+//	POST /admin/replay[?destination=<name>] - replay stored messages of all the workers or of the given destination worker
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/pipes", a.handlePipes)
+	mux.HandleFunc("/admin/pipes/", a.handlePipe)
+	mux.HandleFunc("/admin/flush", a.handleWorkers(Worker.Flush))
+	mux.HandleFunc("/admin/replay", a.handleWorkers(Worker.Replay))
+
+	return a.authorise(mux)
+}
+
+// authorise rejects requests without valid bearer token, tokens are compared in constant time
+func (a *API) authorise(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if len(a.token) == 0 || subtle.ConstantTimeCompare([]byte(token), a.token) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *API) handlePipes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.pipesStats())
+}
+
+// pipesStats collects live state of all the pipes, consumer and worker state is requested once per request
+func (a *API) pipesStats() []PipeStats {
+	consumed := make(map[string]amqp.PipeState)
+	for _, consumer := range a.consumers {
+		for queue, state := range consumer.Pipes() {
+			consumed[queue] = state
+		}
+	}
+
+	buffers := make(map[string]map[string]workers.BufferState, len(a.workers))
+	for destination, worker := range a.workers {
+		buffers[destination] = worker.Buffers()
+	}
+
+	stats := make([]PipeStats, 0, len(a.pipes))
+	for _, pipe := range a.pipes {
+		pipeStats := PipeStats{
+			Kind:       pipe.Direction(),
+			Connection: pipe.Connection(),
+			Queue:      pipe.RabbitQueueName,
+			Topic:      pipe.KafkaTopic,
+			URL:        pipe.HTTPURL,
+		}
+
+		if pipeStats.Kind == config.PipeKindRabbitToKafka {
+			pipeStats.Destinations = pipe.Destinations()
+			pipeStats.Consumers = consumed[pipe.RabbitQueueName].Consumers
+			pipeStats.Paused = consumed[pipe.RabbitQueueName].Paused
+
+			pipeStats.Buffers = make(map[string]workers.BufferState, len(pipeStats.Destinations))
+			for _, destination := range pipeStats.Destinations {
+				pipeStats.Buffers[destination] = buffers[destination][pipe.BufferKey()]
+			}
+		}
+
+		stats = append(stats, pipeStats)
+	}
+
+	return stats
+}
+
+// handlePipe pauses or resumes consumption of the pipe, queue name may contain slashes,
+// so action is taken from the last path segment
+func (a *API) handlePipe(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin/pipes/")
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	queue, action := path[:i], path[i+1:]
+	if action != actionPause && action != actionResume {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	for _, consumer := range a.consumers {
+		var err error
+		if action == actionPause {
+			err = consumer.Pause(queue)
+		} else {
+			err = consumer.Resume(queue)
+		}
+
+		if err == amqp.ErrUnknownPipe {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithField("queue", queue).WithField("action", action).Error("Failed to change pipe consumption")
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		log.WithField("queue", queue).WithField("action", action).Info("Pipe consumption changed by admin API")
+		writeJSON(w, http.StatusOK, consumer.Pipes()[queue])
+		return
+	}
+
+	writeError(w, http.StatusNotFound, amqp.ErrUnknownPipe.Error())
+}
+
+// handleWorkers runs action on all the workers or on the worker of destination given in query,
+// actions are asynchronous, so request is accepted and not waiting for them to be done
+func (a *API) handleWorkers(action func(Worker)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var destinations []string
+		if destination := r.URL.Query().Get("destination"); destination != "" {
+			if _, ok := a.workers[destination]; !ok {
+				writeError(w, http.StatusNotFound, "unknown destination")
+				return
+			}
+			destinations = append(destinations, destination)
+		} else {
+			for destination := range a.workers {
+				destinations = append(destinations, destination)
+			}
+			sort.Strings(destinations)
+		}
+
+		for _, destination := range destinations {
+			action(a.workers[destination])
+		}
+
+		log.WithField("path", r.URL.Path).WithField("destinations", destinations).Info("Workers action requested by admin API")
+		writeJSON(w, http.StatusAccepted, map[string][]string{"destinations": destinations})
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("Failed to write admin API response")
+	}
+}
@@ -0,0 +1,221 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/amqp"
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/workers"
+)
+
+type mockConsumer struct {
+	pipes     map[string]amqp.PipeState
+	resumeErr error
+}
+
+func (c *mockConsumer) Pipes() map[string]amqp.PipeState {
+	return c.pipes
+}
+
+func (c *mockConsumer) Pause(queue string) error {
+	state, ok := c.pipes[queue]
+	if !ok {
+		return amqp.ErrUnknownPipe
+	}
+
+	state.Paused = true
+	c.pipes[queue] = state
+	return nil
+}
+
+func (c *mockConsumer) Resume(queue string) error {
+	state, ok := c.pipes[queue]
+	if !ok {
+		return amqp.ErrUnknownPipe
+	}
+	if c.resumeErr != nil {
+		return c.resumeErr
+	}
+
+	state.Paused = false
+	c.pipes[queue] = state
+	return nil
+}
+
+type mockWorker struct {
+	buffers  map[string]workers.BufferState
+	flushed  int
+	replayed int
+}
+
+func (w *mockWorker) Buffers() map[string]workers.BufferState {
+	return w.buffers
+}
+
+func (w *mockWorker) Flush() {
+	w.flushed++
+}
+
+func (w *mockWorker) Replay() {
+	w.replayed++
+}
+
+func newTestAPI() (*API, []*mockConsumer, map[string]*mockWorker) {
+	pipes := []config.Pipe{
+		{RabbitQueueName: "kandalf-orders", KafkaTopic: "orders"},
+		{RabbitQueueName: "kandalf-payments", KafkaTopic: "payments", RabbitConnection: "payments", HTTPURL: "http://payments.local"},
+		{Kind: config.PipeKindKafkaToRabbit, KafkaTopic: "refunds", RabbitExchangeName: "refunds"},
+	}
+	consumers := []*mockConsumer{
+		{pipes: map[string]amqp.PipeState{"kandalf-orders": {Consumers: 2}}},
+		{pipes: map[string]amqp.PipeState{"kandalf-payments": {Consumers: 1}}, resumeErr: errors.New("channel is closed")},
+	}
+	bridgeWorkers := map[string]*mockWorker{
+		config.DefaultKafkaCluster: {buffers: map[string]workers.BufferState{"orders": {Messages: 3, Bytes: 30}}},
+		config.HTTPDestination:     {buffers: map[string]workers.BufferState{"payments": {Messages: 1, Bytes: 10}}},
+	}
+
+	var pipeConsumers []PipeConsumer
+	for _, consumer := range consumers {
+		pipeConsumers = append(pipeConsumers, consumer)
+	}
+	apiWorkers := make(map[string]Worker, len(bridgeWorkers))
+	for destination, worker := range bridgeWorkers {
+		apiWorkers[destination] = worker
+	}
+
+	return NewAPI("secret", pipes, pipeConsumers, apiWorkers), consumers, bridgeWorkers
+}
+
+func serve(api *API, method, target, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	api.Handler().ServeHTTP(w, r)
+
+	return w
+}
+
+func TestAPI_authorise(t *testing.T) {
+	api, _, _ := newTestAPI()
+
+	for _, token := range []string{"", "wrong", "secret-with-suffix"} {
+		w := serve(api, http.MethodGet, "/admin/pipes", token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, token)
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	}
+
+	// API without token rejects all the requests
+	w := serve(NewAPI("", nil, nil, nil), http.MethodGet, "/admin/pipes", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serve(api, http.MethodGet, "/admin/pipes", "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAPI_pipes(t *testing.T) {
+	api, _, _ := newTestAPI()
+
+	w := serve(api, http.MethodGet, "/admin/pipes", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var stats []PipeStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, []PipeStats{
+		{
+			Kind:         config.PipeKindRabbitToKafka,
+			Connection:   config.DefaultRabbitConnection,
+			Queue:        "kandalf-orders",
+			Topic:        "orders",
+			Destinations: []string{config.DefaultKafkaCluster},
+			Consumers:    2,
+			Buffers:      map[string]workers.BufferState{config.DefaultKafkaCluster: {Messages: 3, Bytes: 30}},
+		},
+		{
+			Kind:         config.PipeKindRabbitToKafka,
+			Connection:   "payments",
+			Queue:        "kandalf-payments",
+			Topic:        "payments",
+			URL:          "http://payments.local",
+			Destinations: []string{config.DefaultKafkaCluster, config.HTTPDestination},
+			Consumers:    1,
+			Buffers: map[string]workers.BufferState{
+				config.DefaultKafkaCluster: {},
+				config.HTTPDestination:     {Messages: 1, Bytes: 10},
+			},
+		},
+		{
+			Kind:       config.PipeKindKafkaToRabbit,
+			Connection: config.DefaultRabbitConnection,
+			Topic:      "refunds",
+		},
+	}, stats)
+
+	w = serve(api, http.MethodPost, "/admin/pipes", "secret")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestAPI_pauseResume(t *testing.T) {
+	api, consumers, _ := newTestAPI()
+
+	w := serve(api, http.MethodPost, "/admin/pipes/kandalf-orders/pause", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"consumers": 2, "paused": true}`, w.Body.String())
+	assert.True(t, consumers[0].pipes["kandalf-orders"].Paused)
+
+	w = serve(api, http.MethodPost, "/admin/pipes/kandalf-orders/resume", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, consumers[0].pipes["kandalf-orders"].Paused)
+
+	// pipe of the second connection is looked up in all the consumers
+	w = serve(api, http.MethodPost, "/admin/pipes/kandalf-payments/pause", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, consumers[1].pipes["kandalf-payments"].Paused)
+
+	w = serve(api, http.MethodPost, "/admin/pipes/kandalf-payments/resume", "secret")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error": "channel is closed"}`, w.Body.String())
+
+	w = serve(api, http.MethodPost, "/admin/pipes/kandalf-unknown/pause", "secret")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "unknown pipe"}`, w.Body.String())
+
+	w = serve(api, http.MethodPost, "/admin/pipes/kandalf-orders/delete", "secret")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(api, http.MethodGet, "/admin/pipes/kandalf-orders/pause", "secret")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestAPI_flushReplay(t *testing.T) {
+	api, _, bridgeWorkers := newTestAPI()
+
+	w := serve(api, http.MethodPost, "/admin/flush", "secret")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"destinations": ["default", "http"]}`, w.Body.String())
+	assert.Equal(t, 1, bridgeWorkers[config.DefaultKafkaCluster].flushed)
+	assert.Equal(t, 1, bridgeWorkers[config.HTTPDestination].flushed)
+
+	w = serve(api, http.MethodPost, "/admin/replay?destination=http", "secret")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"destinations": ["http"]}`, w.Body.String())
+	assert.Equal(t, 0, bridgeWorkers[config.DefaultKafkaCluster].replayed)
+	assert.Equal(t, 1, bridgeWorkers[config.HTTPDestination].replayed)
+
+	w = serve(api, http.MethodPost, "/admin/replay?destination=unknown", "secret")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(api, http.MethodGet, "/admin/flush", "secret")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,5 @@
+/*
+Package admin holds code required for operating running application over HTTP: inspecting pipes,
+pausing and resuming their consumption, flushing worker buffers and replaying messages from storage.
+*/
+package admin
@@ -0,0 +1,44 @@
+package amqp
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultBackoffInitialInterval = time.Second
+	defaultBackoffMaxInterval     = 30 * time.Second
+)
+
+// backoff calculates exponentially growing delays between reconnection attempts with random jitter,
+// so instances that lost connection at the same time do not reconnect all at once
+type backoff struct {
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	attempt         uint
+}
+
+func newBackoff(initialInterval, maxInterval time.Duration) *backoff {
+	if initialInterval <= 0 {
+		initialInterval = defaultBackoffInitialInterval
+	}
+	if maxInterval < initialInterval {
+		maxInterval = initialInterval
+	}
+
+	return &backoff{initialInterval: initialInterval, maxInterval: maxInterval}
+}
+
+// next returns delay before the next attempt, the first half of the delay is fixed and the second one is random
+func (b *backoff) next() time.Duration {
+	delay := b.maxInterval
+	if b.attempt < 32 {
+		if exp := b.initialInterval << b.attempt; exp > 0 && exp < b.maxInterval {
+			delay = exp
+		}
+	}
+	b.attempt++
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
@@ -0,0 +1,28 @@
+package amqp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff_next(t *testing.T) {
+	b := newBackoff(time.Second, 10*time.Second)
+
+	for _, expected := range []time.Duration{1, 2, 4, 8, 10, 10, 10} {
+		delay := b.next()
+		assert.True(t, delay >= expected*time.Second/2, delay)
+		assert.True(t, delay <= expected*time.Second, delay)
+	}
+
+	// delay does not overflow after many attempts
+	b.attempt = 100
+	assert.True(t, b.next() >= 5*time.Second)
+}
+
+func TestNewBackoff_defaults(t *testing.T) {
+	b := newBackoff(0, 0)
+	assert.Equal(t, defaultBackoffInitialInterval, b.initialInterval)
+	assert.Equal(t, defaultBackoffInitialInterval, b.maxInterval)
+}
@@ -1,79 +1,342 @@
 package amqp
 
 import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/hellofresh/stats-go/bucket"
+	"github.com/hellofresh/stats-go/client"
 	amqp "github.com/rabbitmq/amqp091-go"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/health"
+)
+
+const defaultLocale = "en_US"
+
+// State is AMQP connection state
+type State int
+
+const (
+	// StateConnecting is the state of the connection that is being established for the first time
+	StateConnecting State = iota
+	// StateConnected is the state of the established connection with initialised queues
+	StateConnected
+	// StateReconnecting is the state of the lost connection that is being re-established
+	StateReconnecting
+	// StateClosed is the state of the connection closed by application
+	StateClosed
+	// StateFailed is the state of the lost connection that failed to be re-established
+	// in the max number of attempts
+	StateFailed
 )
 
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	case StateFailed:
+		return "failed"
+	}
+
+	return "unknown"
+}
+
 // InitQueuesHandler is a handler function type for AMQP connection
 type InitQueuesHandler func(conn *amqp.Connection) error
 
 // Connection struct holds data for AMQP connection
 type Connection struct {
-	dsn        string
-	initQueues InitQueuesHandler
-	conn       *amqp.Connection
+	dsns         []string
+	dialConfig   amqp.Config
+	rabbitConfig config.RabbitConfig
+	initQueues   InitQueuesHandler
+	statsClient  client.Client
+
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	node      int
+	state     State
+	listeners []chan State
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-// NewConnection instantiates and establishes new AMQP connection
-func NewConnection(dsn string, initQueues InitQueuesHandler) (*Connection, error) {
-	c := &Connection{dsn, initQueues, nil}
+// NewDialConfig builds AMQP connection configuration from application RabbitMQ configuration
+func NewDialConfig(rabbitConfig config.RabbitConfig) (amqp.Config, error) {
+	tlsConfig, err := rabbitConfig.TLS.Config()
+	if err != nil {
+		return amqp.Config{}, err
+	}
 
-	if err := c.establishConnection(); nil != err {
-		return c, err
+	dialConfig := amqp.Config{
+		Vhost:           rabbitConfig.Vhost,
+		ChannelMax:      rabbitConfig.ChannelMax,
+		Heartbeat:       rabbitConfig.Heartbeat,
+		TLSClientConfig: tlsConfig,
+		Locale:          defaultLocale,
+	}
+
+	if rabbitConfig.ConnectionName != "" {
+		dialConfig.Properties = amqp.Table{
+			"product":         "kandalf",
+			"connection_name": rabbitConfig.ConnectionName,
+		}
+	}
+
+	if rabbitConfig.TLS.ExternalAuth {
+		dialConfig.SASL = []amqp.Authentication{&amqp.ExternalAuth{}}
+	}
+
+	return dialConfig, nil
+}
+
+// NewConnection instantiates and establishes new AMQP connection to one of the cluster nodes given by DSNs.
+// Nodes are tried one by one until connection is established, lost connection is re-established
+// starting from the next node with exponential backoff until max number of attempts is reached.
+func NewConnection(dsns []string, rabbitConfig config.RabbitConfig, initQueues InitQueuesHandler, statsClient client.Client) (*Connection, error) {
+	if len(dsns) == 0 {
+		return nil, errors.New("no RabbitMQ DSN is configured")
+	}
+
+	dialConfig, err := NewDialConfig(rabbitConfig)
+	if err != nil {
+		return nil, err
 	}
-	if err := c.initQueues(c.conn); nil != err {
+
+	c := &Connection{
+		dsns:         dsns,
+		dialConfig:   dialConfig,
+		rabbitConfig: rabbitConfig,
+		initQueues:   initQueues,
+		statsClient:  statsClient,
+		state:        StateConnecting,
+		done:         make(chan struct{}),
+	}
+
+	closeNotify, err := c.establishConnection()
+	if err != nil {
 		return c, err
 	}
-	c.initNotifyClose()
+
+	c.setState(StateConnected)
+	go c.supervise(closeNotify)
 
 	return c, nil
 }
 
-// Close closes AMQP connection
+// State returns current connection state
+func (c *Connection) State() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.state
+}
+
+// Health reports connection state, connection that is being established is degraded,
+// closed connection or connection that failed to be re-established is down
+func (c *Connection) Health() health.Component {
+	state := c.State()
+	details := map[string]interface{}{"state": state.String(), "node": c.Node()}
+
+	switch state {
+	case StateConnected:
+		return health.Up(details)
+	case StateConnecting, StateReconnecting:
+		return health.Degraded(nil, details)
+	}
+
+	return health.Component{Status: health.StatusDown, Details: details}
+}
+
+// Node returns address of the cluster node the connection is established to or is going to be established first
+func (c *Connection) Node() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return nodeAddress(c.dsns[c.node])
+}
+
+// NotifyState registers a listener for connection state changes. Notification is dropped
+// if listener is not ready to receive it, so buffered channel should be used.
+func (c *Connection) NotifyState(receiver chan State) chan State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.listeners = append(c.listeners, receiver)
+	return receiver
+}
+
+// Close closes AMQP connection and stops reconnection attempts
 func (c *Connection) Close() error {
-	return c.conn.Close()
+	c.closeOnce.Do(func() { close(c.done) })
+	c.setState(StateClosed)
+
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+
+	if conn == nil || conn.IsClosed() {
+		return nil
+	}
+
+	return conn.Close()
 }
 
-func (c *Connection) establishConnection() error {
-	var err error
+func (c *Connection) setState(state State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	log.WithField("dsn", c.dsn).Info("Establishing RabbitMQ connection")
-	if c.conn, err = amqp.Dial(c.dsn); nil != err {
-		return err
+	// closed connection stays closed no matter what reconnection routine is doing
+	if c.state == state || c.state == StateClosed {
+		return
 	}
 
-	return nil
+	log.WithField("from", c.state.String()).WithField("to", state.String()).Info("AMQP connection state changed")
+	c.state = state
+	for _, listener := range c.listeners {
+		select {
+		case listener <- state:
+		default:
+		}
+	}
 }
 
-func (c *Connection) initNotifyClose() {
-	go func() {
-		shutdownError := <-c.conn.NotifyClose(make(chan *amqp.Error))
-		log.WithField("error", shutdownError).Error("Caught AMQP close notification")
-		if nil != shutdownError {
-			log.WithField("timeout", c.conn.Config.Heartbeat).
-				Info("Caught AMQP close notification with error, trying to reconnect")
-			c.reEstablishConnection(c.conn.Config.Heartbeat)
+// establishConnection dials cluster nodes starting from the current one until connection is established
+// and initialises queues, close notification is subscribed before queues initialisation to not miss connection loss
+func (c *Connection) establishConnection() (chan *amqp.Error, error) {
+	c.mu.RLock()
+	firstNode := c.node
+	c.mu.RUnlock()
+
+	var err error
+	for i := range c.dsns {
+		node := (firstNode + i) % len(c.dsns)
+		address := nodeAddress(c.dsns[node])
+
+		log.WithField("node", address).Info("Establishing RabbitMQ connection")
+		var conn *amqp.Connection
+		conn, err = amqp.DialConfig(c.dsns[node], c.nodeDialConfig(c.dsns[node]))
+		c.statsClient.TrackOperation(statsAMQPSection, bucket.NewMetricOperation(statsOpConnect, "node", address), nil, nil == err)
+		if err != nil {
+			log.WithError(err).WithField("node", address).Warn("Failed to connect to RabbitMQ node")
+			continue
 		}
-	}()
+
+		c.mu.Lock()
+		c.node = node
+		c.mu.Unlock()
+
+		closeNotify := conn.NotifyClose(make(chan *amqp.Error, 1))
+		if err := c.initQueues(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.conn = conn
+		c.mu.Unlock()
+
+		log.WithField("node", address).Info("RabbitMQ connection established")
+		return closeNotify, nil
+	}
+
+	return nil, err
 }
 
-func (c *Connection) reEstablishConnection(timeout time.Duration) {
-	for {
-		time.Sleep(timeout)
-		if err := c.establishConnection(); err != nil {
-			log.WithError(err).WithField("timeout", timeout).
+// nodeDialConfig returns dial config with its own copy of TLS config, as dial sets TLS server name
+// to the node host if it is empty, and it must not stick for the rest of the nodes.
+// EXTERNAL authentication is used only for "amqps" nodes, as there is no client certificate without TLS.
+func (c *Connection) nodeDialConfig(dsn string) amqp.Config {
+	dialConfig := c.dialConfig
+	if dialConfig.TLSClientConfig != nil {
+		dialConfig.TLSClientConfig = dialConfig.TLSClientConfig.Clone()
+	}
+	if u, err := url.Parse(dsn); err != nil || u.Scheme != "amqps" {
+		dialConfig.SASL = nil
+	}
+
+	return dialConfig
+}
+
+// nextNode rotates connection to the next cluster node
+func (c *Connection) nextNode() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.node = (c.node + 1) % len(c.dsns)
+}
+
+// nodeAddress returns host and port of the node from its DSN, so credentials do not leak to logs and metrics
+func nodeAddress(dsn string) string {
+	uri, err := amqp.ParseURI(dsn)
+	if err != nil {
+		return "unknown"
+	}
+
+	return net.JoinHostPort(uri.Host, strconv.Itoa(uri.Port))
+}
+
+// supervise waits for connection to be closed and re-establishes it if it was not closed by application
+func (c *Connection) supervise(closeNotify chan *amqp.Error) {
+	shutdownError := <-closeNotify
+	if shutdownError == nil {
+		return
+	}
+
+	log.WithField("error", shutdownError).WithField("node", c.Node()).
+		Error("Caught AMQP close notification with error, trying to reconnect")
+	c.nextNode()
+	c.reEstablishConnection()
+}
+
+func (c *Connection) reEstablishConnection() {
+	c.setState(StateReconnecting)
+
+	b := newBackoff(c.rabbitConfig.ReconnectInitialInterval, c.rabbitConfig.ReconnectMaxInterval)
+	for attempt := 1; ; attempt++ {
+		if c.rabbitConfig.ReconnectMaxAttempts > 0 && attempt > c.rabbitConfig.ReconnectMaxAttempts {
+			log.WithField("attempts", c.rabbitConfig.ReconnectMaxAttempts).Error("Failed to re-establish AMQP connection, giving up")
+			c.setState(StateFailed)
+			return
+		}
+
+		timeout := b.next()
+		select {
+		case <-c.done:
+			return
+		case <-time.After(timeout):
+		}
+
+		closeNotify, err := c.establishConnection()
+		if err != nil {
+			log.WithError(err).WithField("attempt", attempt).WithField("timeout", timeout).
 				Error("Failed to establish new connection, will try later")
-		} else {
-			if err := c.initQueues(c.conn); nil != err {
-				log.WithError(err).WithField("timeout", timeout).
-					Error("Failed to init new queues, will try later")
-			} else {
-				c.initNotifyClose()
-				break
-			}
+			continue
 		}
+
+		select {
+		case <-c.done:
+			// connection was closed by application while it was being established
+			c.Close()
+			return
+		default:
+		}
+
+		c.setState(StateConnected)
+		go c.supervise(closeNotify)
+		return
 	}
 }
@@ -0,0 +1,394 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hellofresh/stats-go/bucket"
+	"github.com/hellofresh/stats-go/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/health"
+)
+
+var (
+	// ErrUnknownPipe is an error raised when consumer does not consume pipe with given queue name
+	ErrUnknownPipe = errors.New("unknown pipe")
+
+	errConsumerStopped = errors.New("AMQP consumer is stopped")
+)
+
+// PipeState is a state of pipe consumption
+type PipeState struct {
+	// Consumers is a number of goroutines consuming pipe messages
+	Consumers int `json:"consumers"`
+	// Paused is true if pipe consumption is paused
+	Paused bool `json:"paused"`
+}
+
+// Consumer consumes messages of "rabbit-to-kafka" pipes, every pipe is consumed using its own AMQP channel,
+// so channel level errors of one pipe do not affect others
+type Consumer struct {
+	pipes        []config.Pipe
+	rabbitConfig config.RabbitConfig
+	handler      MessageHandler
+	statsClient  client.Client
+
+	mu        sync.Mutex
+	consumers map[string]*pipeConsumer
+	active    map[string]int
+	paused    map[string]bool
+	stopped   bool
+	handlers  sync.WaitGroup
+}
+
+// NewConsumer instantiates new consumer for given pipes
+func NewConsumer(pipes []config.Pipe, rabbitConfig config.RabbitConfig, handler MessageHandler, statsClient client.Client) *Consumer {
+	return &Consumer{
+		pipes:        pipes,
+		rabbitConfig: rabbitConfig,
+		handler:      handler,
+		statsClient:  statsClient,
+		consumers:    make(map[string]*pipeConsumer),
+		active:       make(map[string]int),
+		paused:       make(map[string]bool),
+	}
+}
+
+// Init starts consuming messages of all the pipes, it is called every time connection is established
+func (c *Consumer) Init(conn *amqp.Connection) error {
+	for _, pipe := range c.pipes {
+		consumer := &pipeConsumer{conn: conn, pipe: pipe, consumer: c}
+		if err := consumer.start(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stop cancels consumers of all the pipes, so RabbitMQ stops delivering messages, and waits for the messages
+// that are already delivered to be handled or for the context to be done. Channels are left open,
+// so handled messages can still be acknowledged.
+func (c *Consumer) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	c.stopped = true
+	for queue, consumer := range c.consumers {
+		if c.paused[queue] {
+			continue
+		}
+		if err := consumer.cancel(); err != nil {
+			log.WithError(err).WithField("pipe", consumer.pipe.String()).Warn("Failed to cancel AMQP consumer")
+		}
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause stops consuming messages of the pipe with given queue name, messages that are already delivered
+// are still handled. Paused pipe is not consumed after channel or connection is re-established until it is resumed.
+func (c *Consumer) Pause(queue string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.hasPipe(queue) {
+		return ErrUnknownPipe
+	}
+	if c.paused[queue] {
+		return nil
+	}
+	c.paused[queue] = true
+
+	consumer, ok := c.consumers[queue]
+	if !ok || c.stopped {
+		return nil
+	}
+
+	log.WithField("pipe", consumer.pipe.String()).Info("Pausing AMQP pipe consumption")
+	return consumer.cancel()
+}
+
+// Resume starts consuming messages of the paused pipe with given queue name again
+func (c *Consumer) Resume(queue string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.hasPipe(queue) {
+		return ErrUnknownPipe
+	}
+	if !c.paused[queue] {
+		return nil
+	}
+	delete(c.paused, queue)
+
+	consumer, ok := c.consumers[queue]
+	if !ok || c.stopped {
+		return nil
+	}
+
+	log.WithField("pipe", consumer.pipe.String()).Info("Resuming AMQP pipe consumption")
+	if err := c.consume(consumer); err != nil && err != amqp.ErrClosed {
+		c.paused[queue] = true
+		return err
+	}
+
+	return nil
+}
+
+// Pipes returns consumption state of every pipe by its queue name
+func (c *Consumer) Pipes() map[string]PipeState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pipes := make(map[string]PipeState, len(c.pipes))
+	for _, pipe := range c.pipes {
+		pipes[pipe.RabbitQueueName] = PipeState{Consumers: c.active[pipe.RabbitQueueName], Paused: c.paused[pipe.RabbitQueueName]}
+	}
+
+	return pipes
+}
+
+// Health reports number of goroutines consuming messages of every pipe by its queue name,
+// consumer is degraded if some of the pipes that are not paused is not consumed by all its goroutines,
+// e.g. while channel is reopened
+func (c *Consumer) Health() health.Component {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	consumers := make(map[string]int, len(c.pipes))
+	var missing, paused []string
+	for _, pipe := range c.pipes {
+		consumers[pipe.RabbitQueueName] = c.active[pipe.RabbitQueueName]
+		if c.paused[pipe.RabbitQueueName] {
+			paused = append(paused, pipe.RabbitQueueName)
+			continue
+		}
+		if c.active[pipe.RabbitQueueName] < pipe.Consumers() {
+			missing = append(missing, pipe.RabbitQueueName)
+		}
+	}
+
+	details := map[string]interface{}{"consumers": consumers}
+	if len(paused) > 0 {
+		details["paused"] = paused
+	}
+	if c.stopped {
+		return health.Degraded(errConsumerStopped, details)
+	}
+	if len(missing) > 0 {
+		return health.Degraded(fmt.Errorf("pipes are not consumed: %s", strings.Join(missing, ", ")), details)
+	}
+
+	return health.Up(details)
+}
+
+func (c *Consumer) hasPipe(queue string) bool {
+	for _, pipe := range c.pipes {
+		if pipe.RabbitQueueName == queue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// attach keeps track of pipe consumer with opened channel, so it can be paused and stopped later,
+// and starts consuming pipe messages unless the pipe is paused. Channel opened after consumer is stopped
+// is closed, so the messages delivered to it are requeued.
+func (c *Consumer) attach(consumer *pipeConsumer, channel *amqp.Channel, queueName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return channel.Close()
+	}
+
+	consumer.channel, consumer.queueName = channel, queueName
+
+	c.consumers[consumer.pipe.RabbitQueueName] = consumer
+	if c.paused[consumer.pipe.RabbitQueueName] {
+		return nil
+	}
+
+	return c.consume(consumer)
+}
+
+// consume registers AMQP consumer and starts pipe handlers, it must be called under consumer lock
+func (c *Consumer) consume(consumer *pipeConsumer) error {
+	pipe := consumer.pipe
+
+	operation := bucket.NewMetricOperation(statsOpConnect, "consume", consumer.queueName)
+	messages, err := consumer.channel.Consume(consumer.queueName, consumer.consumerTag(), false, false, false, false, nil)
+	c.statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
+	if err != nil {
+		log.WithError(err).WithField("pipe", pipe.String()).Error("Failed to register a consumer")
+		return err
+	}
+
+	// all goroutines read from the same deliveries channel, so prefetch limits apply to them altogether
+	c.active[pipe.RabbitQueueName] += pipe.Consumers()
+	c.handlers.Add(pipe.Consumers())
+	for i := 0; i < pipe.Consumers(); i++ {
+		go func() {
+			defer c.unregister(pipe)
+			consumeMessages(messages, pipe, c.handler, c.statsClient)
+		}()
+	}
+
+	return nil
+}
+
+// unregister stops counting pipe handler, it is called once handler is done
+func (c *Consumer) unregister(pipe config.Pipe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active[pipe.RabbitQueueName]--
+	c.handlers.Done()
+}
+
+func (c *Consumer) isStopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stopped
+}
+
+// pipeConsumer consumes messages of a single pipe using its own AMQP channel
+type pipeConsumer struct {
+	conn     *amqp.Connection
+	pipe     config.Pipe
+	consumer *Consumer
+
+	channel   *amqp.Channel
+	queueName string
+}
+
+// start opens pipe channel, declares pipe topology and starts consuming messages
+func (c *pipeConsumer) start() error {
+	statsClient := c.consumer.statsClient
+
+	operation := bucket.NewMetricOperation(statsOpConnect, "channel", c.pipe.RabbitQueueName)
+	channel, err := c.conn.Channel()
+	statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
+	if err != nil {
+		log.WithError(err).WithField("pipe", c.pipe.String()).Error("Failed to open AMQP channel")
+		return err
+	}
+
+	closeNotify := channel.NotifyClose(make(chan *amqp.Error, 1))
+	cancelNotify := channel.NotifyCancel(make(chan string, 1))
+
+	queueName, err := c.declare(channel)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	if err := c.consumer.attach(c, channel, queueName); err != nil {
+		channel.Close()
+		return err
+	}
+
+	go c.watch(channel, closeNotify, cancelNotify)
+
+	return nil
+}
+
+// declare sets channel QoS and declares pipe topology, it returns the name of declared queue
+func (c *pipeConsumer) declare(channel *amqp.Channel) (string, error) {
+	declareMode := c.pipe.DeclareMode(c.consumer.rabbitConfig.DeclareMode)
+
+	if err := channel.Qos(c.pipe.RabbitPrefetchCount, c.pipe.RabbitPrefetchSize, false); err != nil {
+		log.WithError(err).WithField("pipe", c.pipe.String()).Error("Failed to set AMQP channel QoS")
+		return "", err
+	}
+
+	queueName, err := declareTopology(channel, c.pipe, declareMode, c.consumer.statsClient)
+	if err != nil {
+		log.WithError(err).WithField("pipe", c.pipe.String()).Error("Failed to declare pipe topology")
+		return "", err
+	}
+
+	return queueName, nil
+}
+
+func (c *pipeConsumer) consumerTag() string {
+	return c.queueName + "_consumer"
+}
+
+// cancel stops server from delivering pipe messages, channel that is already closed has nothing to cancel
+func (c *pipeConsumer) cancel() error {
+	if err := c.channel.Cancel(c.consumerTag(), false); err != nil && err != amqp.ErrClosed {
+		return err
+	}
+
+	return nil
+}
+
+// watch waits for the pipe channel to be closed or consumer to be cancelled by server, e.g. when queue is deleted,
+// and reopens the channel. Connection level errors are handled by connection itself.
+func (c *pipeConsumer) watch(channel *amqp.Channel, closeNotify chan *amqp.Error, cancelNotify chan string) {
+	select {
+	case closeErr := <-closeNotify:
+		if closeErr == nil || c.conn.IsClosed() {
+			return
+		}
+		log.WithError(closeErr).WithField("pipe", c.pipe.String()).
+			Error("Caught AMQP channel close notification, trying to reopen")
+	case consumerTag, ok := <-cancelNotify:
+		// cancel notification channel is closed together with the channel
+		if !ok {
+			c.watch(channel, closeNotify, nil)
+			return
+		}
+		log.WithField("consumer", consumerTag).WithField("pipe", c.pipe.String()).
+			Warn("AMQP consumer was cancelled by server, trying to resubscribe")
+		if err := channel.Close(); err != nil {
+			log.WithError(err).WithField("pipe", c.pipe.String()).Error("Failed to close AMQP channel")
+		}
+	}
+
+	c.recover()
+}
+
+// recover reopens pipe channel with exponential backoff while connection is alive and consumer is not stopped
+func (c *pipeConsumer) recover() {
+	rabbitConfig := c.consumer.rabbitConfig
+
+	b := newBackoff(rabbitConfig.ReconnectInitialInterval, rabbitConfig.ReconnectMaxInterval)
+	for {
+		timeout := b.next()
+		time.Sleep(timeout)
+		if c.conn.IsClosed() || c.consumer.isStopped() {
+			return
+		}
+
+		if err := c.start(); err != nil {
+			log.WithError(err).WithField("pipe", c.pipe.String()).WithField("timeout", timeout).
+				Error("Failed to reopen AMQP channel, will try later")
+			continue
+		}
+
+		log.WithField("pipe", c.pipe.String()).Info("AMQP channel reopened")
+		return
+	}
+}
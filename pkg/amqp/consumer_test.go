@@ -0,0 +1,114 @@
+package amqp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/stats-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/health"
+)
+
+func TestConsumer_Stop(t *testing.T) {
+	statsClient, _ := stats.NewClient("noop://")
+	consumer := NewConsumer([]config.Pipe{{RabbitQueueName: "kandalf-orders"}}, config.RabbitConfig{}, nil, statsClient)
+
+	assert.NoError(t, consumer.Stop(context.Background()))
+	assert.True(t, consumer.isStopped())
+
+	// stopped consumer is not resumed
+	assert.NoError(t, consumer.Pause("kandalf-orders"))
+	assert.NoError(t, consumer.Resume("kandalf-orders"))
+	assert.Equal(t, map[string]PipeState{"kandalf-orders": {}}, consumer.Pipes())
+}
+
+func TestConsumer_Stop_handlers(t *testing.T) {
+	statsClient, _ := stats.NewClient("noop://")
+	consumer := NewConsumer([]config.Pipe{{RabbitQueueName: "kandalf-orders"}}, config.RabbitConfig{}, nil, statsClient)
+	consumer.handlers.Add(1)
+
+	// handler that does not finish in time is abandoned
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, consumer.Stop(ctx))
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- consumer.Stop(context.Background())
+	}()
+	consumer.handlers.Done()
+
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("consumer is not stopped after messages are handled")
+	}
+}
+
+func TestConsumer_Health(t *testing.T) {
+	statsClient, _ := stats.NewClient("noop://")
+	orders := config.Pipe{RabbitQueueName: "kandalf-orders", RabbitConsumers: 2}
+	payments := config.Pipe{RabbitQueueName: "kandalf-payments"}
+	consumer := NewConsumer([]config.Pipe{orders, payments}, config.RabbitConfig{}, nil, statsClient)
+
+	trackHandlers(consumer, orders)
+	component := consumer.Health()
+	assert.Equal(t, health.StatusDegraded, component.Status)
+	assert.Equal(t, "pipes are not consumed: kandalf-payments", component.Error)
+
+	trackHandlers(consumer, payments)
+	component = consumer.Health()
+	assert.Equal(t, health.StatusUp, component.Status)
+	assert.Equal(t, map[string]int{"kandalf-orders": 2, "kandalf-payments": 1}, component.Details["consumers"])
+
+	// one of the pipe goroutines is done, e.g. because channel is closed
+	consumer.unregister(orders)
+	component = consumer.Health()
+	assert.Equal(t, health.StatusDegraded, component.Status)
+	assert.Equal(t, map[string]int{"kandalf-orders": 1, "kandalf-payments": 1}, component.Details["consumers"])
+}
+
+func TestConsumer_Pause(t *testing.T) {
+	statsClient, _ := stats.NewClient("noop://")
+	orders := config.Pipe{RabbitQueueName: "kandalf-orders"}
+	payments := config.Pipe{RabbitQueueName: "kandalf-payments"}
+	consumer := NewConsumer([]config.Pipe{orders, payments}, config.RabbitConfig{}, nil, statsClient)
+	trackHandlers(consumer, orders)
+
+	assert.Equal(t, ErrUnknownPipe, consumer.Pause("kandalf-unknown"))
+	assert.Equal(t, ErrUnknownPipe, consumer.Resume("kandalf-unknown"))
+
+	// pipe without opened channel is consumed as soon as it is opened unless it is paused
+	require.NoError(t, consumer.Pause("kandalf-payments"))
+	require.NoError(t, consumer.Pause("kandalf-payments"))
+	assert.Equal(t, map[string]PipeState{
+		"kandalf-orders":   {Consumers: 1},
+		"kandalf-payments": {Paused: true},
+	}, consumer.Pipes())
+
+	// paused pipe is not reported as not consumed
+	component := consumer.Health()
+	assert.Equal(t, health.StatusUp, component.Status)
+	assert.Equal(t, []string{"kandalf-payments"}, component.Details["paused"])
+
+	require.NoError(t, consumer.Resume("kandalf-payments"))
+	assert.Equal(t, PipeState{}, consumer.Pipes()["kandalf-payments"])
+
+	component = consumer.Health()
+	assert.Equal(t, health.StatusDegraded, component.Status)
+	assert.Equal(t, "pipes are not consumed: kandalf-payments", component.Error)
+}
+
+// trackHandlers counts pipe handlers as if pipe was consumed
+func trackHandlers(consumer *Consumer, pipe config.Pipe) {
+	consumer.mu.Lock()
+	defer consumer.mu.Unlock()
+
+	consumer.active[pipe.RabbitQueueName] += pipe.Consumers()
+	consumer.handlers.Add(pipe.Consumers())
+}
@@ -1,4 +1,4 @@
 /*
-Package amqp holds code required for reading messages from RabbitMQ.
+Package amqp holds code required for reading messages from RabbitMQ and publishing messages to it.
 */
 package amqp
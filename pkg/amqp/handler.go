@@ -1,12 +1,17 @@
 package amqp
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/hellofresh/stats-go/bucket"
 	"github.com/hellofresh/stats-go/client"
 	amqp "github.com/rabbitmq/amqp091-go"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/producer"
 )
 
 const (
@@ -17,63 +22,32 @@ const (
 	statsOpConsume   = "consume"
 )
 
-// MessageHandler is a handler function type for consumed messages
-type MessageHandler func(body []byte, pipe config.Pipe) error
+// MessageHandler is a handler function type for consumed messages.
+// If handler returns nil it takes responsibility for acknowledging the message using given acknowledger,
+// otherwise message is rejected and requeued.
+type MessageHandler func(body []byte, headers map[string]string, pipe config.Pipe, acknowledger producer.Acknowledger) error
 
-// NewQueuesHandler instantiates queues initialisation handler
-func NewQueuesHandler(pipes []config.Pipe, handler MessageHandler, statsClient client.Client) InitQueuesHandler {
-	return func(conn *amqp.Connection) error {
-		operation := bucket.NewMetricOperation(statsOpConnect, "channel")
-		channel, err := conn.Channel()
-		statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
-		if err != nil {
-			log.WithError(err).Error("Failed to open AMQP channel")
-			return err
-		}
-
-		for _, pipe := range pipes {
-			operation = bucket.NewMetricOperation(statsOpConnect, "exchange", pipe.RabbitExchangeName)
-			err = channel.ExchangeDeclare(
-				pipe.RabbitExchangeName,
-				exchangeTypeTopic,
-				!pipe.RabbitTransientExchange,
-				false,
-				false,
-				false,
-				nil,
-			)
-			statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
-			if err != nil {
-				log.WithError(err).Error("Failed to declare exchange")
-				return err
-			}
+type deliveryAcknowledger struct {
+	delivery amqp.Delivery
+}
 
-			operation = bucket.NewMetricOperation(statsOpConnect, "queue", pipe.RabbitQueueName)
-			queue, err := channel.QueueDeclare(pipe.RabbitQueueName, pipe.RabbitDurableQueue, pipe.RabbitAutoDeleteQueue, false, true, nil)
-			statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
-			if err != nil {
-				log.WithError(err).Error("Failed to declare queue")
-				return err
-			}
+// Ack acknowledges AMQP delivery
+func (a deliveryAcknowledger) Ack() error {
+	return a.delivery.Ack(false)
+}
 
-			for i := range pipe.RabbitRoutingKey {
-				operation = bucket.NewMetricOperation(statsOpConnect, "bind", pipe.RabbitRoutingKey[i])
-				err = channel.QueueBind(queue.Name, pipe.RabbitRoutingKey[i], pipe.RabbitExchangeName, true, nil)
-				statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
-				if err != nil {
-					log.WithError(err).Error("Failed to bind the queue")
-					return err
-				}
-			}
+// Nack negatively acknowledges AMQP delivery
+func (a deliveryAcknowledger) Nack(requeue bool) error {
+	return a.delivery.Nack(false, requeue)
+}
 
-			ch, err := channel.Consume(queue.Name, queue.Name+"_consumer", false, false, false, false, nil)
-			statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
-			if err != nil {
-				log.WithError(err).Error("Failed to register a consumer")
-				return nil
+// ChainInitQueuesHandlers combines several initialisation handlers into one, handlers are called in given order
+func ChainInitQueuesHandlers(handlers ...InitQueuesHandler) InitQueuesHandler {
+	return func(conn *amqp.Connection) error {
+		for _, handler := range handlers {
+			if err := handler(conn); err != nil {
+				return err
 			}
-
-			go consumeMessages(ch, pipe, handler, statsClient)
 		}
 
 		return nil
@@ -82,7 +56,7 @@ func NewQueuesHandler(pipes []config.Pipe, handler MessageHandler, statsClient c
 
 func consumeMessages(messages <-chan amqp.Delivery, pipe config.Pipe, handler MessageHandler, statsClient client.Client) {
 	for msg := range messages {
-		err := handler(msg.Body, pipe)
+		err := handler(msg.Body, deliveryHeaders(msg), pipe, deliveryAcknowledger{msg})
 
 		operation := bucket.NewMetricOperation(statsOpConsume, pipe.RabbitQueueName)
 		statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
@@ -92,10 +66,51 @@ func consumeMessages(messages <-chan amqp.Delivery, pipe config.Pipe, handler Me
 			if err = msg.Nack(false, true); err != nil {
 				log.WithError(err).WithField("pipe", pipe.String()).Error("Failed to NAck AMQP message")
 			}
-		} else {
-			if err = msg.Ack(false); err != nil {
-				log.WithError(err).WithField("pipe", pipe.String()).Error("Failed to NAck AMQP message")
-			}
 		}
 	}
 }
+
+// deliveryHeaders collects AMQP message properties and custom headers as plain string values
+func deliveryHeaders(msg amqp.Delivery) map[string]string {
+	headers := make(map[string]string, len(msg.Headers)+6)
+	for name, value := range msg.Headers {
+		headers[name] = headerValue(value)
+	}
+
+	properties := map[string]string{
+		producer.HeaderExchange:      msg.Exchange,
+		producer.HeaderRoutingKey:    msg.RoutingKey,
+		producer.HeaderContentType:   msg.ContentType,
+		producer.HeaderCorrelationID: msg.CorrelationId,
+		producer.HeaderMessageID:     msg.MessageId,
+	}
+	if !msg.Timestamp.IsZero() {
+		properties[producer.HeaderTimestamp] = msg.Timestamp.UTC().Format(time.RFC3339)
+	}
+	for name, value := range properties {
+		if value != "" {
+			headers[name] = value
+		}
+	}
+
+	return headers
+}
+
+func headerValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case amqp.Table, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,58 @@
+package amqp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hellofresh/kandalf/pkg/producer"
+)
+
+func TestDeliveryHeaders(t *testing.T) {
+	timestamp := time.Date(2017, time.March, 1, 12, 30, 0, 0, time.UTC)
+	msg := amqp.Delivery{
+		Exchange:      "customers",
+		RoutingKey:    "order.created",
+		ContentType:   "application/json",
+		CorrelationId: "correlation-id",
+		Timestamp:     timestamp,
+		Headers: amqp.Table{
+			"x-tenant":  "de",
+			"x-retries": int32(3),
+			"x-binary":  []byte("binary"),
+			"x-nested":  amqp.Table{"key": "value"},
+		},
+	}
+
+	assert.Equal(t, map[string]string{
+		producer.HeaderExchange:      "customers",
+		producer.HeaderRoutingKey:    "order.created",
+		producer.HeaderContentType:   "application/json",
+		producer.HeaderCorrelationID: "correlation-id",
+		producer.HeaderTimestamp:     "2017-03-01T12:30:00Z",
+		"x-tenant":                   "de",
+		"x-retries":                  "3",
+		"x-binary":                   "binary",
+		"x-nested":                   `{"key":"value"}`,
+	}, deliveryHeaders(msg))
+}
+
+func TestChainInitQueuesHandlers(t *testing.T) {
+	var calls []string
+	handler := func(name string, err error) InitQueuesHandler {
+		return func(conn *amqp.Connection) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	assert.NoError(t, ChainInitQueuesHandlers(handler("consumer", nil), handler("publisher", nil))(nil))
+	assert.Equal(t, []string{"consumer", "publisher"}, calls)
+
+	calls = nil
+	assert.Error(t, ChainInitQueuesHandlers(handler("consumer", errors.New("failed")), handler("publisher", nil))(nil))
+	assert.Equal(t, []string{"consumer"}, calls)
+}
@@ -0,0 +1,322 @@
+package amqp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hellofresh/stats-go/bucket"
+	"github.com/hellofresh/stats-go/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/kafka"
+	"github.com/hellofresh/kandalf/pkg/producer"
+)
+
+const (
+	statsOpPublish = "publish"
+
+	publishConfirmTimeout = 30 * time.Second
+)
+
+var (
+	errPublisherNotConnected = errors.New("AMQP connection is not established")
+	errPublishNotConfirmed   = errors.New("AMQP channel is closed before message is confirmed")
+	errPublishNacked         = errors.New("message is negatively acknowledged by AMQP broker")
+	errPublishReturned       = errors.New("message is returned by AMQP broker")
+)
+
+// Publisher publishes messages of "kafka-to-rabbit" pipes to RabbitMQ exchanges using publisher confirms.
+// Messages are published as mandatory, so message that is not routed to any queue fails instead of being dropped.
+// Only publishing itself is serialised, confirmations are tracked by delivery tag, so publish calls
+// of different pipes do not wait for each other confirmations.
+type Publisher struct {
+	pipes        []config.Pipe
+	rabbitConfig config.RabbitConfig
+	statsClient  client.Client
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *publishChannel
+}
+
+// NewPublisher instantiates new publisher for given pipes
+func NewPublisher(pipes []config.Pipe, rabbitConfig config.RabbitConfig, statsClient client.Client) *Publisher {
+	return &Publisher{pipes: pipes, rabbitConfig: rabbitConfig, statsClient: statsClient}
+}
+
+// Init declares pipes exchanges and opens publishing channel, it is called every time connection is established
+func (p *Publisher) Init(conn *amqp.Connection) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.conn = conn
+	p.channel = nil
+
+	channel, err := conn.Channel()
+	if err != nil {
+		log.WithError(err).Error("Failed to open AMQP publishing channel")
+		return err
+	}
+
+	for _, pipe := range p.pipes {
+		declareMode := pipe.DeclareMode(p.rabbitConfig.DeclareMode)
+		// default exchange always exists and can not be declared
+		if declareMode == config.DeclareModeSkip || pipe.RabbitExchangeName == "" {
+			continue
+		}
+
+		if err := declareExchange(channel, pipe, declareMode, p.statsClient); err != nil {
+			log.WithError(err).WithField("pipe", pipe.String()).Error("Failed to declare pipe exchange")
+			channel.Close()
+			return err
+		}
+	}
+
+	if err := p.useChannel(channel); err != nil {
+		channel.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Publish publishes message to the exchange and waits for the broker to confirm it
+func (p *Publisher) Publish(exchange, routingKey string, msg kafka.Message) error {
+	operation := bucket.NewMetricOperation(statsOpPublish, exchange)
+	err := p.publish(exchange, routingKey, newPublishing(msg))
+	p.statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
+
+	return err
+}
+
+func (p *Publisher) publish(exchange, routingKey string, publishing amqp.Publishing) error {
+	channel, pending, err := p.send(exchange, routingKey, publishing)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-pending.result:
+		return err
+	case <-time.After(publishConfirmTimeout):
+		// late confirmation is ignored, as it is matched by delivery tag
+		channel.forget(pending.tag)
+		return fmt.Errorf("message is not confirmed by AMQP broker in %s", publishConfirmTimeout)
+	}
+}
+
+// send publishes message to the publishing channel, channel is reopened if it was closed by the broker
+// on channel level errors, e.g. when exchange does not exist
+func (p *Publisher) send(exchange, routingKey string, publishing amqp.Publishing) (*publishChannel, *pendingPublish, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.channel == nil || p.channel.channel.IsClosed() {
+		if p.conn == nil || p.conn.IsClosed() {
+			return nil, nil, errPublisherNotConnected
+		}
+
+		channel, err := p.conn.Channel()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := p.useChannel(channel); err != nil {
+			channel.Close()
+			return nil, nil, err
+		}
+	}
+
+	// delivery tag is known before publishing, as all the publish calls are serialised
+	channel := p.channel
+	pending := channel.track(channel.channel.GetNextPublishSeqNo(), exchange, routingKey, publishing.Body)
+	if err := channel.channel.Publish(exchange, routingKey, true, false, publishing); err != nil {
+		channel.forget(pending.tag)
+		return nil, nil, err
+	}
+
+	return channel, pending, nil
+}
+
+// useChannel puts channel into confirm mode and uses it for publishing
+func (p *Publisher) useChannel(channel *amqp.Channel) error {
+	if err := channel.Confirm(false); err != nil {
+		log.WithError(err).Error("Failed to put AMQP channel into confirm mode")
+		return err
+	}
+
+	p.channel = newPublishChannel(channel)
+	go p.channel.watch(
+		channel.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		channel.NotifyReturn(make(chan amqp.Return, 1)),
+	)
+
+	return nil
+}
+
+// pendingPublish is a message waiting for the broker confirmation
+type pendingPublish struct {
+	tag        uint64
+	exchange   string
+	routingKey string
+	body       []byte
+	returned   error
+	result     chan error
+}
+
+// publishChannel tracks confirmations and returns of the messages published to the channel
+type publishChannel struct {
+	channel *amqp.Channel
+
+	mu      sync.Mutex
+	pending map[uint64]*pendingPublish
+}
+
+func newPublishChannel(channel *amqp.Channel) *publishChannel {
+	return &publishChannel{channel: channel, pending: make(map[uint64]*pendingPublish)}
+}
+
+// track registers message published with given delivery tag as waiting for confirmation
+func (c *publishChannel) track(tag uint64, exchange, routingKey string, body []byte) *pendingPublish {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := &pendingPublish{tag: tag, exchange: exchange, routingKey: routingKey, body: body, result: make(chan error, 1)}
+	c.pending[tag] = pending
+
+	return pending
+}
+
+// forget stops waiting for confirmation of the message with given delivery tag
+func (c *publishChannel) forget(tag uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, tag)
+}
+
+// watch reports confirmations of published messages until channel is closed, messages that are not confirmed
+// by then fail. Broker sends return of unroutable message before its confirmation, so return is always
+// handled before confirmation it belongs to.
+func (c *publishChannel) watch(confirms chan amqp.Confirmation, returns chan amqp.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.markReturned(ret)
+		case confirm, ok := <-confirms:
+			if !ok {
+				c.failPending(errPublishNotConfirmed)
+				return
+			}
+			c.drainReturns(returns)
+			c.confirm(confirm)
+		}
+	}
+}
+
+func (c *publishChannel) drainReturns(returns chan amqp.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+			c.markReturned(ret)
+		default:
+			return
+		}
+	}
+}
+
+// markReturned fails the earliest message waiting for confirmation that matches returned one, returns come
+// in the order messages are published
+func (c *publishChannel) markReturned(ret amqp.Return) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var returned *pendingPublish
+	for _, pending := range c.pending {
+		if pending.returned != nil || pending.exchange != ret.Exchange || pending.routingKey != ret.RoutingKey ||
+			!bytes.Equal(pending.body, ret.Body) {
+			continue
+		}
+		if returned == nil || pending.tag < returned.tag {
+			returned = pending
+		}
+	}
+
+	if returned == nil {
+		log.WithField("exchange", ret.Exchange).WithField("routing_key", ret.RoutingKey).
+			Warn("Got AMQP return of the message that is not waiting for confirmation")
+		return
+	}
+	returned.returned = fmt.Errorf("%w: %d %s", errPublishReturned, ret.ReplyCode, ret.ReplyText)
+}
+
+func (c *publishChannel) confirm(confirm amqp.Confirmation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending, ok := c.pending[confirm.DeliveryTag]
+	if !ok {
+		return
+	}
+	delete(c.pending, confirm.DeliveryTag)
+
+	switch {
+	case !confirm.Ack:
+		pending.result <- errPublishNacked
+	case pending.returned != nil:
+		pending.result <- pending.returned
+	default:
+		pending.result <- nil
+	}
+}
+
+func (c *publishChannel) failPending(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for tag, pending := range c.pending {
+		pending.result <- err
+		delete(c.pending, tag)
+	}
+}
+
+// newPublishing converts Kafka message to AMQP message, headers produced by "rabbit-to-kafka" pipes
+// are turned back into message properties
+func newPublishing(msg kafka.Message) amqp.Publishing {
+	publishing := amqp.Publishing{
+		Body:         msg.Body,
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    msg.Timestamp,
+	}
+
+	for name, value := range msg.Headers {
+		switch name {
+		case producer.HeaderContentType:
+			publishing.ContentType = value
+		case producer.HeaderCorrelationID:
+			publishing.CorrelationId = value
+		case producer.HeaderMessageID:
+			publishing.MessageId = value
+		case producer.HeaderExchange, producer.HeaderRoutingKey, producer.HeaderTimestamp:
+			// these are set by the publishing itself
+		default:
+			if publishing.Headers == nil {
+				publishing.Headers = make(amqp.Table, len(msg.Headers))
+			}
+			publishing.Headers[name] = value
+		}
+	}
+
+	return publishing
+}
@@ -0,0 +1,94 @@
+package amqp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/stats-go"
+	"github.com/hellofresh/stats-go/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/kafka"
+	"github.com/hellofresh/kandalf/pkg/producer"
+)
+
+func TestNewPublishing(t *testing.T) {
+	timestamp := time.Date(2017, time.March, 1, 12, 30, 0, 0, time.UTC)
+	publishing := newPublishing(kafka.Message{
+		Body:      []byte("body"),
+		Timestamp: timestamp,
+		Headers: map[string]string{
+			producer.HeaderExchange:      "customers",
+			producer.HeaderRoutingKey:    "order.created",
+			producer.HeaderContentType:   "application/json",
+			producer.HeaderCorrelationID: "correlation-id",
+			producer.HeaderMessageID:     "message-id",
+			"x-customer-id":              "42",
+		},
+	})
+
+	assert.Equal(t, []byte("body"), publishing.Body)
+	assert.Equal(t, amqp.Persistent, publishing.DeliveryMode)
+	assert.Equal(t, timestamp, publishing.Timestamp)
+	assert.Equal(t, "application/json", publishing.ContentType)
+	assert.Equal(t, "correlation-id", publishing.CorrelationId)
+	assert.Equal(t, "message-id", publishing.MessageId)
+	assert.Equal(t, amqp.Table{"x-customer-id": "42"}, publishing.Headers)
+
+	assert.Nil(t, newPublishing(kafka.Message{Body: []byte("body")}).Headers)
+}
+
+func TestPublisher_Publish_notConnected(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	publisher := NewPublisher([]config.Pipe{{Kind: config.PipeKindKafkaToRabbit, RabbitExchangeName: "logistics"}}, config.RabbitConfig{}, statsClient)
+
+	err := publisher.Publish("logistics", "shipment.created", kafka.Message{Body: []byte("body")})
+	assert.Equal(t, errPublisherNotConnected, err)
+
+	memoryStats, _ := statsClient.(*client.Memory)
+	assert.Equal(t, 1, memoryStats.CountMetrics["amqp-fail.publish.logistics.-"])
+}
+
+func TestPublishChannel_watch(t *testing.T) {
+	channel := newPublishChannel(nil)
+	confirms := make(chan amqp.Confirmation)
+	returns := make(chan amqp.Return, 1)
+	watched := make(chan struct{})
+	go func() {
+		channel.watch(confirms, returns)
+		close(watched)
+	}()
+
+	created := channel.track(1, "logistics", "shipment.created", []byte("shipment #1"))
+	unroutable := channel.track(2, "logistics", "shipment.unknown", []byte("shipment #1"))
+	nacked := channel.track(3, "logistics", "shipment.created", []byte("shipment #2"))
+	late := channel.track(4, "logistics", "shipment.created", []byte("shipment #3"))
+	closed := channel.track(5, "logistics", "shipment.created", []byte("shipment #4"))
+
+	// return is sent by broker right before confirmation of unroutable message
+	returns <- amqp.Return{Exchange: "logistics", RoutingKey: "shipment.unknown", Body: []byte("shipment #1"), ReplyCode: 312, ReplyText: "NO_ROUTE"}
+	confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: true}
+	err := <-unroutable.result
+	assert.True(t, errors.Is(err, errPublishReturned))
+	assert.Equal(t, "message is returned by AMQP broker: 312 NO_ROUTE", err.Error())
+
+	// confirmations are matched by delivery tag
+	confirms <- amqp.Confirmation{DeliveryTag: 3, Ack: false}
+	assert.Equal(t, errPublishNacked, <-nacked.result)
+	confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	assert.NoError(t, <-created.result)
+
+	// message that is not waited for anymore is not confirmed
+	channel.forget(late.tag)
+	confirms <- amqp.Confirmation{DeliveryTag: 4, Ack: true}
+	assert.Empty(t, late.result)
+
+	close(returns)
+	close(confirms)
+	assert.Equal(t, errPublishNotConfirmed, <-closed.result)
+	<-watched
+	assert.Empty(t, channel.pending)
+}
@@ -0,0 +1,51 @@
+package amqp
+
+import (
+	"fmt"
+	"math"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// newTable converts arguments loaded from pipes config to AMQP table, nil is returned for empty arguments
+func newTable(args map[string]interface{}) amqp.Table {
+	if len(args) == 0 {
+		return nil
+	}
+
+	table := make(amqp.Table, len(args))
+	for name, value := range args {
+		table[name] = tableValue(value)
+	}
+
+	return table
+}
+
+// tableValue converts config value to the type supported by AMQP table: nested maps decoded from YAML
+// have non-string keys and whole numbers decoded from JSON are floats, while RabbitMQ expects integers
+// for arguments like "x-message-ttl"
+func tableValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return newTable(v)
+	case map[interface{}]interface{}:
+		table := make(amqp.Table, len(v))
+		for name, nestedValue := range v {
+			table[fmt.Sprint(name)] = tableValue(nestedValue)
+		}
+		return table
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = tableValue(v[i])
+		}
+		return values
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return int64(v)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,32 @@
+package amqp
+
+import (
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTable(t *testing.T) {
+	assert.Nil(t, newTable(nil))
+	assert.Nil(t, newTable(map[string]interface{}{}))
+
+	table := newTable(map[string]interface{}{
+		"x-queue-type":  "quorum",
+		"x-message-ttl": float64(60000),
+		"x-ratio":       0.5,
+		"x-max-length":  1000,
+		"x-nested":      map[interface{}]interface{}{"key": "value", 1: []interface{}{float64(2)}},
+		"x-list":        []interface{}{"a", float64(1)},
+	})
+
+	assert.Equal(t, amqp.Table{
+		"x-queue-type":  "quorum",
+		"x-message-ttl": int64(60000),
+		"x-ratio":       0.5,
+		"x-max-length":  1000,
+		"x-nested":      amqp.Table{"key": "value", "1": []interface{}{int64(2)}},
+		"x-list":        []interface{}{"a", int64(1)},
+	}, table)
+	assert.NoError(t, table.Validate())
+}
@@ -0,0 +1,138 @@
+package amqp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hellofresh/stats-go/bucket"
+	"github.com/hellofresh/stats-go/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+// topologyChannel is a part of AMQP channel used to declare pipes topology
+type topologyChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+}
+
+// declareTopology declares pipe exchange, queue and bindings according to declare mode
+// and returns the name of the queue to consume messages from
+func declareTopology(channel topologyChannel, pipe config.Pipe, declareMode string, statsClient client.Client) (string, error) {
+	switch declareMode {
+	case config.DeclareModeSkip:
+		return pipe.RabbitQueueName, nil
+	case config.DeclareModeDeclare, config.DeclareModePassive:
+	default:
+		return "", fmt.Errorf("unknown rabbit declare mode %q", declareMode)
+	}
+
+	passive := declareMode == config.DeclareModePassive
+
+	// default exchange always exists and can not be declared, every queue is bound to it by its name
+	if pipe.RabbitExchangeName != "" {
+		if err := declareExchange(channel, pipe, declareMode, statsClient); err != nil {
+			return "", err
+		}
+	}
+
+	queueDeclare := channel.QueueDeclare
+	if passive {
+		queueDeclare = channel.QueueDeclarePassive
+	}
+
+	operation := bucket.NewMetricOperation(statsOpConnect, "queue", pipe.RabbitQueueName)
+	queue, err := queueDeclare(
+		pipe.RabbitQueueName,
+		pipe.RabbitDurableQueue,
+		pipe.RabbitAutoDeleteQueue,
+		false,
+		false,
+		newTable(pipe.RabbitQueueArgs),
+	)
+	statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
+	if err != nil {
+		return "", declareError(err, "queue", pipe.RabbitQueueName, declareMode)
+	}
+
+	// queue is expected to be bound by the topology owner
+	if passive || pipe.RabbitExchangeName == "" {
+		return queue.Name, nil
+	}
+
+	// fanout and headers exchanges ignore routing key, so queue is bound once with empty one
+	routingKeys := pipe.RabbitRoutingKey
+	if len(routingKeys) == 0 {
+		routingKeys = []string{""}
+	}
+
+	for i := range routingKeys {
+		operation = bucket.NewMetricOperation(statsOpConnect, "bind", routingKeys[i])
+		err = channel.QueueBind(queue.Name, routingKeys[i], pipe.RabbitExchangeName, false, newTable(pipe.RabbitBindingArgs))
+		statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
+		if err != nil {
+			return "", declareError(err, "binding", fmt.Sprintf("%s -> %s (%s)", pipe.RabbitExchangeName, queue.Name, routingKeys[i]), declareMode)
+		}
+	}
+
+	return queue.Name, nil
+}
+
+// declareExchange declares pipe exchange or checks that it exists in passive declare mode
+func declareExchange(channel topologyChannel, pipe config.Pipe, declareMode string, statsClient client.Client) error {
+	exchangeType := pipe.RabbitExchangeType
+	if exchangeType == "" {
+		exchangeType = exchangeTypeTopic
+	}
+
+	exchangeDeclare := channel.ExchangeDeclare
+	if declareMode == config.DeclareModePassive {
+		exchangeDeclare = channel.ExchangeDeclarePassive
+	}
+
+	operation := bucket.NewMetricOperation(statsOpConnect, "exchange", pipe.RabbitExchangeName)
+	err := exchangeDeclare(
+		pipe.RabbitExchangeName,
+		exchangeType,
+		!pipe.RabbitTransientExchange,
+		false,
+		false,
+		false,
+		newTable(pipe.RabbitExchangeArgs),
+	)
+	statsClient.TrackOperation(statsAMQPSection, operation, nil, nil == err)
+	if err != nil {
+		return declareError(err, "exchange", pipe.RabbitExchangeName, declareMode)
+	}
+
+	return nil
+}
+
+// declareError explains the most common topology declaration failures
+func declareError(err error, kind, name, declareMode string) error {
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) {
+		return fmt.Errorf("failed to declare %s %q: %w", kind, name, err)
+	}
+
+	switch amqpErr.Code {
+	case amqp.NotFound:
+		return fmt.Errorf("%s %q does not exist, it must be declared before using %q declare mode: %w", kind, name, declareMode, err)
+	case amqp.PreconditionFailed:
+		return fmt.Errorf("%s %q already exists with different settings, fix pipe settings or use %q or %q declare mode: %w",
+			kind, name, config.DeclareModePassive, config.DeclareModeSkip, err)
+	case amqp.AccessRefused:
+		// passive declare does not require configure permission
+		if declareMode == config.DeclareModePassive {
+			return fmt.Errorf("access to %s %q is refused: %w", kind, name, err)
+		}
+		return fmt.Errorf("access to %s %q is refused, user may lack configure permission required for %q declare mode: %w",
+			kind, name, declareMode, err)
+	}
+
+	return fmt.Errorf("failed to declare %s %q: %w", kind, name, err)
+}
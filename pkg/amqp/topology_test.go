@@ -0,0 +1,165 @@
+package amqp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hellofresh/stats-go"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+type mockTopologyChannel struct {
+	calls []string
+	err   error
+}
+
+func (c *mockTopologyChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	c.calls = append(c.calls, fmt.Sprintf("ExchangeDeclare %s %s %v", name, kind, args))
+	return c.err
+}
+
+func (c *mockTopologyChannel) ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	c.calls = append(c.calls, fmt.Sprintf("ExchangeDeclarePassive %s %s", name, kind))
+	return c.err
+}
+
+func (c *mockTopologyChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.calls = append(c.calls, fmt.Sprintf("QueueDeclare %s %v", name, args))
+	return amqp.Queue{Name: name}, c.err
+}
+
+func (c *mockTopologyChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.calls = append(c.calls, fmt.Sprintf("QueueDeclarePassive %s", name))
+	return amqp.Queue{Name: name}, c.err
+}
+
+func (c *mockTopologyChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	c.calls = append(c.calls, fmt.Sprintf("QueueBind %s %s %s %v", name, key, exchange, args))
+	return c.err
+}
+
+func TestDeclareTopology(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+
+	pipe := config.Pipe{
+		RabbitExchangeName: "customers",
+		RabbitRoutingKey:   []string{"order.created", "order.cancelled"},
+		RabbitQueueName:    "kandalf-customers",
+		RabbitQueueArgs:    map[string]interface{}{"x-queue-type": "quorum"},
+	}
+
+	channel := &mockTopologyChannel{}
+	queueName, err := declareTopology(channel, pipe, config.DeclareModeDeclare, statsClient)
+	require.NoError(t, err)
+	assert.Equal(t, "kandalf-customers", queueName)
+	assert.Equal(t, []string{
+		"ExchangeDeclare customers topic map[]",
+		"QueueDeclare kandalf-customers map[x-queue-type:quorum]",
+		"QueueBind kandalf-customers order.created customers map[]",
+		"QueueBind kandalf-customers order.cancelled customers map[]",
+	}, channel.calls)
+
+	channel = &mockTopologyChannel{}
+	queueName, err = declareTopology(channel, pipe, config.DeclareModePassive, statsClient)
+	require.NoError(t, err)
+	assert.Equal(t, "kandalf-customers", queueName)
+	assert.Equal(t, []string{
+		"ExchangeDeclarePassive customers topic",
+		"QueueDeclarePassive kandalf-customers",
+	}, channel.calls)
+
+	channel = &mockTopologyChannel{}
+	queueName, err = declareTopology(channel, pipe, config.DeclareModeSkip, statsClient)
+	require.NoError(t, err)
+	assert.Equal(t, "kandalf-customers", queueName)
+	assert.Empty(t, channel.calls)
+
+	_, err = declareTopology(&mockTopologyChannel{}, pipe, "unknown", statsClient)
+	assert.Error(t, err)
+}
+
+func TestDeclareTopology_headersExchange(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+
+	pipe := config.Pipe{
+		RabbitExchangeName: "payments",
+		RabbitExchangeType: "headers",
+		RabbitQueueName:    "kandalf-payments",
+		RabbitBindingArgs:  map[string]interface{}{"x-match": "all"},
+	}
+
+	channel := &mockTopologyChannel{}
+	_, err := declareTopology(channel, pipe, config.DeclareModeDeclare, statsClient)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"ExchangeDeclare payments headers map[]",
+		"QueueDeclare kandalf-payments map[]",
+		"QueueBind kandalf-payments  payments map[x-match:all]",
+	}, channel.calls)
+}
+
+func TestDeclareTopology_queueOnly(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	pipe := config.Pipe{RabbitQueueName: "kandalf-customers"}
+
+	channel := &mockTopologyChannel{}
+	queueName, err := declareTopology(channel, pipe, config.DeclareModePassive, statsClient)
+	require.NoError(t, err)
+	assert.Equal(t, "kandalf-customers", queueName)
+	assert.Equal(t, []string{"QueueDeclarePassive kandalf-customers"}, channel.calls)
+
+	channel = &mockTopologyChannel{}
+	_, err = declareTopology(channel, pipe, config.DeclareModeDeclare, statsClient)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"QueueDeclare kandalf-customers map[]"}, channel.calls)
+}
+
+func TestDeclareTopology_errors(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	pipe := config.Pipe{RabbitExchangeName: "customers", RabbitQueueName: "kandalf-customers"}
+
+	channel := &mockTopologyChannel{err: &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no exchange 'customers'"}}
+	_, err := declareTopology(channel, pipe, config.DeclareModePassive, statsClient)
+	assert.EqualError(t, err, `exchange "customers" does not exist, it must be declared before using "passive" declare mode: Exception (404) Reason: "NOT_FOUND - no exchange 'customers'"`)
+
+	channel = &mockTopologyChannel{err: &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - inequivalent arg 'durable'"}}
+	_, err = declareTopology(channel, pipe, config.DeclareModeDeclare, statsClient)
+	assert.EqualError(t, err, `exchange "customers" already exists with different settings, fix pipe settings or use "passive" or "skip" declare mode: Exception (406) Reason: "PRECONDITION_FAILED - inequivalent arg 'durable'"`)
+
+	channel = &mockTopologyChannel{err: &amqp.Error{Code: amqp.AccessRefused, Reason: "ACCESS_REFUSED"}}
+	_, err = declareTopology(channel, pipe, config.DeclareModeDeclare, statsClient)
+	assert.Contains(t, err.Error(), "user may lack configure permission")
+
+	channel = &mockTopologyChannel{err: &amqp.Error{Code: amqp.AccessRefused, Reason: "ACCESS_REFUSED"}}
+	_, err = declareTopology(channel, pipe, config.DeclareModePassive, statsClient)
+	assert.NotContains(t, err.Error(), "configure permission")
+
+	channel = &mockTopologyChannel{err: amqp.ErrClosed}
+	_, err = declareTopology(channel, pipe, config.DeclareModeDeclare, statsClient)
+	assert.ErrorIs(t, err, amqp.ErrClosed)
+}
+
+func TestDeclareExchange(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	pipe := config.Pipe{
+		Kind:               config.PipeKindKafkaToRabbit,
+		RabbitExchangeName: "delayed",
+		RabbitExchangeType: "x-delayed-message",
+		RabbitExchangeArgs: map[string]interface{}{"x-delayed-type": "topic"},
+	}
+
+	channel := &mockTopologyChannel{}
+	require.NoError(t, declareExchange(channel, pipe, config.DeclareModeDeclare, statsClient))
+	assert.Equal(t, []string{"ExchangeDeclare delayed x-delayed-message map[x-delayed-type:topic]"}, channel.calls)
+
+	channel = &mockTopologyChannel{}
+	require.NoError(t, declareExchange(channel, pipe, config.DeclareModePassive, statsClient))
+	assert.Equal(t, []string{"ExchangeDeclarePassive delayed x-delayed-message"}, channel.calls)
+
+	channel = &mockTopologyChannel{err: &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND"}}
+	assert.Error(t, declareExchange(channel, pipe, config.DeclareModePassive, statsClient))
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"crypto/tls"
 	"time"
 
 	"github.com/hellofresh/logging-go"
@@ -9,22 +10,125 @@ import (
 	"github.com/spf13/viper"
 )
 
+const (
+	// DeliveryModeAtMostOnce acknowledges AMQP message as soon as it is put to worker cache
+	DeliveryModeAtMostOnce = "at-most-once"
+	// DeliveryModeAtLeastOnce acknowledges AMQP message only after it is published to Kafka
+	// or put to persistent storage, otherwise message is rejected and requeued
+	DeliveryModeAtLeastOnce = "at-least-once"
+
+	// BackpressureBlock blocks AMQP consumer until worker has room for the message,
+	// so RabbitMQ stops delivering messages once consumer prefetch limit is reached
+	BackpressureBlock = "block"
+	// BackpressureNack rejects and requeues AMQP message worker has no room for
+	BackpressureNack = "nack"
+
+	// PartitionerHash uses FNV-1a hash of message key to choose Kafka partition, random partition for empty key
+	PartitionerHash = "hash"
+	// PartitionerMurmur2 uses murmur2 hash of message key to choose Kafka partition,
+	// the same way Java client default partitioner does
+	PartitionerMurmur2 = "murmur2"
+	// PartitionerRoundRobin chooses Kafka partitions in a round robin manner
+	PartitionerRoundRobin = "round-robin"
+	// PartitionerRandom chooses random Kafka partition
+	PartitionerRandom = "random"
+	// PartitionerManual sends message to the partition configured in the pipe
+	PartitionerManual = "manual"
+
+	// ProducerModeSync publishes messages to Kafka waiting for every publish call result
+	ProducerModeSync = "sync"
+	// ProducerModeAsync publishes messages to Kafka without waiting, results are reported per message
+	// as soon as Kafka acknowledges them
+	ProducerModeAsync = "async"
+
+	// DeclareModeDeclare declares RabbitMQ exchanges and queues and binds queues to exchanges
+	DeclareModeDeclare = "declare"
+	// DeclareModePassive only checks that RabbitMQ exchanges and queues exist, queues are not bound
+	DeclareModePassive = "passive"
+	// DeclareModeSkip consumes RabbitMQ queues without any topology declarations
+	DeclareModeSkip = "skip"
+)
+
 // GlobalConfig contains application configuration values
 type GlobalConfig struct {
-	// RabbitDSN is DSN for RabbitMQ instance to consume messages from
-	RabbitDSN string `envconfig:"RABBIT_DSN"`
+	// RabbitDSN is a list of DSNs of RabbitMQ cluster nodes to consume messages from,
+	// connection fails over to the next node if current one is not available
+	RabbitDSN []string `envconfig:"RABBIT_DSN"`
 	// StorageDSN is DSN for persistent storage used in case of Kafka unavailability. Example:
 	//  redis://redis.local/?key=storage:key
 	StorageDSN string `envconfig:"STORAGE_DSN"`
 
+	// RabbitConnections is a list of additional named RabbitMQ connections pipes can consume messages from,
+	// can be set in config file only
+	RabbitConnections []RabbitConnectionConfig `ignored:"true"`
+
+	// KafkaClusters is a list of additional named Kafka clusters pipes can publish messages to,
+	// can be set in config file only
+	KafkaClusters []KafkaClusterConfig `ignored:"true"`
+
+	// Rabbit contains configuration values for RabbitMQ connection
+	Rabbit RabbitConfig
 	// Log contains configuration values logging
 	Log logging.LogConfig
 	// Kafka contains configuration values for Kafka
 	Kafka KafkaConfig
+	// HTTP contains configuration values for HTTP destinations
+	HTTP HTTPConfig
 	// Stats contains configuration values for stats
 	Stats StatsConfig
 	// Worker contains configuration values for actual bridge worker
 	Worker WorkerConfig
+	// Admin contains configuration values for admin API
+	Admin AdminConfig
+}
+
+// RabbitConfig contains application configuration values for RabbitMQ connection
+type RabbitConfig struct {
+	// Heartbeat is connection heartbeat interval, less than 1s uses the server's interval, default is 10s
+	Heartbeat time.Duration `envconfig:"RABBIT_HEARTBEAT"`
+	// Vhost is RabbitMQ virtual host, overrides the one from DSN if set
+	Vhost string `envconfig:"RABBIT_VHOST"`
+	// ConnectionName is the client provided connection name shown in RabbitMQ management UI, default is "kandalf"
+	ConnectionName string `envconfig:"RABBIT_CONNECTION_NAME"`
+	// ChannelMax is max number of channels per connection, 0 means the server's limit
+	ChannelMax int `envconfig:"RABBIT_CHANNEL_MAX"`
+	// DeclareMode defines how pipes topology is declared, one of "declare", "passive" and "skip",
+	// default is "declare". Can be overridden per pipe.
+	DeclareMode string `envconfig:"RABBIT_DECLARE_MODE"`
+	// ReconnectInitialInterval is delay before the first reconnection attempt, every next delay is doubled
+	// and randomised, default is 1s
+	ReconnectInitialInterval time.Duration `envconfig:"RABBIT_RECONNECT_INITIAL_INTERVAL"`
+	// ReconnectMaxInterval is max delay between reconnection attempts, default is 30s
+	ReconnectMaxInterval time.Duration `envconfig:"RABBIT_RECONNECT_MAX_INTERVAL"`
+	// ReconnectMaxAttempts is max number of reconnection attempts in a row before application gives up,
+	// 0 means unlimited
+	ReconnectMaxAttempts int `envconfig:"RABBIT_RECONNECT_MAX_ATTEMPTS"`
+	// TLS contains TLS configuration values for RabbitMQ connection
+	TLS RabbitTLSConfig
+}
+
+// RabbitTLSConfig contains TLS configuration values for RabbitMQ connection,
+// they are applied only to "amqps://" DSN
+type RabbitTLSConfig struct {
+	// CAFile is a path to PEM encoded CA certificates file used to verify server certificate,
+	// system CA certificates are used if empty
+	CAFile string `envconfig:"RABBIT_TLS_CA_FILE"`
+	// CertFile is a path to PEM encoded client certificate file
+	CertFile string `envconfig:"RABBIT_TLS_CERT_FILE"`
+	// KeyFile is a path to PEM encoded client private key file
+	KeyFile string `envconfig:"RABBIT_TLS_KEY_FILE"`
+	// InsecureSkipVerify turns off server certificate verification
+	InsecureSkipVerify bool `envconfig:"RABBIT_TLS_INSECURE_SKIP_VERIFY"`
+	// ServerName is used to verify server certificate host name, DSN host is used if empty
+	ServerName string `envconfig:"RABBIT_TLS_SERVER_NAME"`
+	// ExternalAuth turns on EXTERNAL authentication mechanism, so client is authenticated
+	// by its certificate instead of DSN user and password
+	ExternalAuth bool `envconfig:"RABBIT_TLS_EXTERNAL_AUTH"`
+}
+
+// Config builds TLS configuration for RabbitMQ connection
+func (c RabbitTLSConfig) Config() (*tls.Config, error) {
+	return newTLSConfig(c.CAFile, c.CertFile, c.KeyFile, c.ServerName, c.InsecureSkipVerify)
 }
 
 // KafkaConfig contains application configuration values for Kafka
@@ -50,6 +154,68 @@ type KafkaConfig struct {
 	//
 	// Default path is "/etc/kandalf/conf/pipes.yml".
 	PipesConfig string `envconfig:"KAFKA_PIPES_CONFIG"`
+	// Partitioner defines how Kafka partition is chosen for the message,
+	// one of "hash", "murmur2", "round-robin", "random" and "manual", default is "hash"
+	Partitioner string `envconfig:"KAFKA_PARTITIONER"`
+	// ProducerMode defines how messages are published to Kafka, one of "sync" and "async", default is "sync"
+	ProducerMode string `envconfig:"KAFKA_PRODUCER_MODE"`
+	// MaxInFlight is max number of messages published in "async" producer mode that are not acknowledged
+	// by Kafka yet, publishing blocks when it is reached, default is 1000
+	MaxInFlight int `envconfig:"KAFKA_MAX_IN_FLIGHT"`
+	// TLS contains TLS configuration values for Kafka connection
+	TLS KafkaTLSConfig
+	// SASL contains SASL authentication configuration values for Kafka connection
+	SASL KafkaSASLConfig
+}
+
+// KafkaTLSConfig contains TLS configuration values for Kafka connection
+type KafkaTLSConfig struct {
+	// Enabled turns on TLS for Kafka connection
+	Enabled bool `envconfig:"KAFKA_TLS_ENABLED"`
+	// CAFile is a path to PEM encoded CA certificates file used to verify brokers certificates,
+	// system CA certificates are used if empty
+	CAFile string `envconfig:"KAFKA_TLS_CA_FILE"`
+	// CertFile is a path to PEM encoded client certificate file
+	CertFile string `envconfig:"KAFKA_TLS_CERT_FILE"`
+	// KeyFile is a path to PEM encoded client private key file
+	KeyFile string `envconfig:"KAFKA_TLS_KEY_FILE"`
+	// InsecureSkipVerify turns off brokers certificates verification
+	InsecureSkipVerify bool `envconfig:"KAFKA_TLS_INSECURE_SKIP_VERIFY"`
+	// ServerName is used to verify brokers certificates host name
+	ServerName string `envconfig:"KAFKA_TLS_SERVER_NAME"`
+}
+
+// Config builds TLS configuration for Kafka connection
+func (c KafkaTLSConfig) Config() (*tls.Config, error) {
+	return newTLSConfig(c.CAFile, c.CertFile, c.KeyFile, c.ServerName, c.InsecureSkipVerify)
+}
+
+// KafkaSASLConfig contains SASL authentication configuration values for Kafka connection
+type KafkaSASLConfig struct {
+	// Enabled turns on SASL authentication for Kafka connection
+	Enabled bool `envconfig:"KAFKA_SASL_ENABLED"`
+	// Mechanism is SASL mechanism, one of "PLAIN", "SCRAM-SHA-256" and "SCRAM-SHA-512", default is "PLAIN"
+	Mechanism string `envconfig:"KAFKA_SASL_MECHANISM"`
+	// User is SASL authentication user name
+	User string `envconfig:"KAFKA_SASL_USER"`
+	// Password is SASL authentication password
+	Password string `envconfig:"KAFKA_SASL_PASSWORD"`
+}
+
+// HTTPConfig contains application configuration values for publishing messages to HTTP destinations
+type HTTPConfig struct {
+	// Timeout is a single request timeout, default is 10s
+	Timeout time.Duration `envconfig:"HTTP_TIMEOUT"`
+	// MaxRetry is total number of times to retry sending a message, default is 3
+	MaxRetry int `envconfig:"HTTP_MAX_RETRY"`
+	// RetryInterval is delay before the first retry, every next delay is doubled, default is 1s
+	RetryInterval time.Duration `envconfig:"HTTP_RETRY_INTERVAL"`
+	// SuccessCodes is a list of response codes message is considered to be delivered with,
+	// code class can be set as well, e.g. "2xx", default is "2xx"
+	SuccessCodes []string `envconfig:"HTTP_SUCCESS_CODES"`
+	// RetryCodes is a list of response codes message sending is retried on, default is "429,5xx".
+	// Message fails right away on all the other codes.
+	RetryCodes []string `envconfig:"HTTP_RETRY_CODES"`
 }
 
 // StatsConfig contains application configuration values for stats.
@@ -60,31 +226,90 @@ type StatsConfig struct {
 	Port          int    `envconfig:"STATS_PORT"`
 }
 
+// AdminConfig contains application configuration values for admin API served on stats port
+type AdminConfig struct {
+	// Token is a bearer token admin API requests must be authorised with, API is disabled if token is empty
+	Token string `envconfig:"ADMIN_TOKEN"`
+}
+
 // WorkerConfig contains application configuration values for actual bridge worker
 type WorkerConfig struct {
-	// CycleTimeout is worker cycle sleep time to avoid CPU overload
+	// CycleTimeout is not used anymore as worker sleeps until it has something to do
+	//
+	// Deprecated: kept to not break existing configs
 	CycleTimeout time.Duration `envconfig:"WORKER_CYCLE_TIMEOUT"`
 	// CacheSize is max messages number that we store in memory before trying to publish to Kafka
 	CacheSize int `envconfig:"WORKER_CACHE_SIZE"`
 	// CacheFlushTimeout is max amount of time we store messages in memory before trying to publish to Kafka
 	CacheFlushTimeout time.Duration `envconfig:"WORKER_CACHE_FLUSH_TIMEOUT"`
-	// ReadTimeout is timeout between attempts of reading persisted messages from storage
-	// to publish them to Kafka, must be at least 2x greater than CycleTimeout
+	// CacheMaxBytes is max total size of messages bodies that we store in memory before trying to publish to Kafka,
+	// 0 means unlimited
+	CacheMaxBytes int `envconfig:"WORKER_CACHE_MAX_BYTES"`
+	// StorageReadTimeout is timeout between attempts of reading persisted messages from storage
+	// to publish them to Kafka
 	StorageReadTimeout time.Duration `envconfig:"WORKER_STORAGE_READ_TIMEOUT"`
 	// StorageMaxErrors is max storage read errors in a row before worker stops trying reading in current
 	// read cycle. Next read cycle will be in "StorageReadTimeout" interval.
 	StorageMaxErrors int `envconfig:"WORKER_STORAGE_MAX_ERRORS"`
+	// DeliveryMode defines when consumed AMQP message is acknowledged, one of "at-most-once" and "at-least-once"
+	DeliveryMode string `envconfig:"WORKER_DELIVERY_MODE"`
+	// MaxMessages is max number of messages worker holds in memory, including the ones that are being published,
+	// 0 means unlimited
+	MaxMessages int `envconfig:"WORKER_MAX_MESSAGES"`
+	// MaxBytes is max total size of messages bodies worker holds in memory, 0 means unlimited
+	MaxBytes int `envconfig:"WORKER_MAX_BYTES"`
+	// Backpressure defines how consumed message is handled when worker holds max messages or bytes,
+	// one of "block" and "nack"
+	Backpressure string `envconfig:"WORKER_BACKPRESSURE"`
+	// ShutdownTimeout is max amount of time application waits for consumed messages to be published or stored
+	// on shutdown before closing connections
+	ShutdownTimeout time.Duration `envconfig:"WORKER_SHUTDOWN_TIMEOUT"`
+}
+
+// BufferConfig defines when messages buffered in memory are published, every topic has its own buffer
+type BufferConfig struct {
+	// Size is max messages number in buffer
+	Size int
+	// FlushTimeout is max amount of time message stays in buffer
+	FlushTimeout time.Duration
+	// MaxBytes is max total size of messages bodies in buffer, 0 means unlimited
+	MaxBytes int
+}
+
+// Buffer returns default messages buffer settings
+func (c WorkerConfig) Buffer() BufferConfig {
+	return BufferConfig{Size: c.CacheSize, FlushTimeout: c.CacheFlushTimeout, MaxBytes: c.CacheMaxBytes}
 }
 
 func init() {
 	viper.SetDefault("logLevel", "info")
+	viper.SetDefault("rabbit.heartbeat", time.Second*time.Duration(10))
+	viper.SetDefault("rabbit.connectionName", "kandalf")
+	viper.SetDefault("rabbit.declareMode", DeclareModeDeclare)
+	viper.SetDefault("rabbit.reconnectInitialInterval", time.Second)
+	viper.SetDefault("rabbit.reconnectMaxInterval", time.Second*time.Duration(30))
 	viper.SetDefault("kafka.maxRetry", 5)
 	viper.SetDefault("kafka.pipesConfig", "/etc/kandalf/conf/pipes.yml")
+	viper.SetDefault("kafka.partitioner", PartitionerHash)
+	viper.SetDefault("kafka.producerMode", ProducerModeSync)
+	viper.SetDefault("kafka.maxInFlight", 1000)
+	viper.SetDefault("kafka.sasl.mechanism", "PLAIN")
+	viper.SetDefault("http.timeout", time.Second*time.Duration(10))
+	viper.SetDefault("http.maxRetry", 3)
+	viper.SetDefault("http.retryInterval", time.Second)
+	viper.SetDefault("http.successCodes", []string{"2xx"})
+	viper.SetDefault("http.retryCodes", []string{"429", "5xx"})
 	viper.SetDefault("worker.cycleTimeout", time.Second*time.Duration(2))
 	viper.SetDefault("worker.cacheSize", 10)
 	viper.SetDefault("worker.cacheFlushTimeout", time.Second*time.Duration(5))
+	viper.SetDefault("worker.cacheMaxBytes", 0)
 	viper.SetDefault("worker.storageReadTimeout", time.Second*time.Duration(10))
 	viper.SetDefault("worker.storageMaxErrors", 10)
+	viper.SetDefault("worker.deliveryMode", DeliveryModeAtMostOnce)
+	viper.SetDefault("worker.maxMessages", 100000)
+	viper.SetDefault("worker.maxBytes", 256*1024*1024)
+	viper.SetDefault("worker.backpressure", BackpressureBlock)
+	viper.SetDefault("worker.shutdownTimeout", time.Second*time.Duration(30))
 	viper.SetDefault("stats.dsn", "log://")
 	viper.SetDefault("stats.errorsSection", "error-log")
 	viper.SetDefault("stats.port", "8080")
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// DefaultRabbitConnection is the name of RabbitMQ connection configured with "RabbitDSN",
+// it is used by pipes that do not reference any connection
+const DefaultRabbitConnection = "default"
+
+// DefaultKafkaCluster is the name of Kafka cluster configured with "Kafka.Brokers",
+// it is used by pipes that do not reference any cluster
+const DefaultKafkaCluster = "default"
+
+// HTTPDestination is the name of HTTP destination, it is used by pipes that have HTTP URL
+const HTTPDestination = "http"
+
+// RabbitConnectionConfig contains configuration values for named RabbitMQ connection
+type RabbitConnectionConfig struct {
+	// Name is connection name pipes reference it by
+	Name string
+	// DSN is a list of DSNs of RabbitMQ cluster nodes
+	DSN []string
+	// Rabbit overrides global RabbitMQ connection configuration values, values that are not set
+	// are taken from global configuration. TLS configuration is overridden as a whole. Vhost is not taken
+	// from global configuration if any of connection DSNs has one.
+	Rabbit RabbitConfig
+}
+
+// RabbitSources returns all RabbitMQ connections pipes can consume messages from: default one configured
+// with "RabbitDSN" if it is set, and named ones with global configuration values applied
+func (c GlobalConfig) RabbitSources() ([]RabbitConnectionConfig, error) {
+	var sources []RabbitConnectionConfig
+	if len(c.RabbitDSN) > 0 {
+		sources = append(sources, RabbitConnectionConfig{Name: DefaultRabbitConnection, DSN: c.RabbitDSN, Rabbit: c.Rabbit})
+	}
+
+	names := map[string]bool{DefaultRabbitConnection: true}
+	for _, connection := range c.RabbitConnections {
+		if connection.Name == "" {
+			return nil, errors.New("rabbit connection name is required")
+		}
+		if names[connection.Name] {
+			return nil, fmt.Errorf("rabbit connection %q is defined more than once", connection.Name)
+		}
+		if len(connection.DSN) == 0 {
+			return nil, fmt.Errorf("rabbit connection %q has no DSN", connection.Name)
+		}
+		names[connection.Name] = true
+
+		defaults := c.Rabbit
+		if dsnHasVhost(connection.DSN) {
+			defaults.Vhost = ""
+		}
+		connection.Rabbit = connection.Rabbit.withDefaults(defaults)
+		sources = append(sources, connection)
+	}
+
+	if len(sources) == 0 {
+		return nil, errors.New("no RabbitMQ connection is configured")
+	}
+
+	return sources, nil
+}
+
+func (c RabbitConfig) withDefaults(defaults RabbitConfig) RabbitConfig {
+	if c.Heartbeat == 0 {
+		c.Heartbeat = defaults.Heartbeat
+	}
+	if c.Vhost == "" {
+		c.Vhost = defaults.Vhost
+	}
+	if c.ConnectionName == "" {
+		c.ConnectionName = defaults.ConnectionName
+	}
+	if c.ChannelMax == 0 {
+		c.ChannelMax = defaults.ChannelMax
+	}
+	if c.DeclareMode == "" {
+		c.DeclareMode = defaults.DeclareMode
+	}
+	if c.ReconnectInitialInterval == 0 {
+		c.ReconnectInitialInterval = defaults.ReconnectInitialInterval
+	}
+	if c.ReconnectMaxInterval == 0 {
+		c.ReconnectMaxInterval = defaults.ReconnectMaxInterval
+	}
+	if c.ReconnectMaxAttempts == 0 {
+		c.ReconnectMaxAttempts = defaults.ReconnectMaxAttempts
+	}
+	if c.TLS == (RabbitTLSConfig{}) {
+		c.TLS = defaults.TLS
+	}
+
+	return c
+}
+
+// dsnHasVhost checks if any of RabbitMQ DSNs has vhost path, e.g. "amqp://rmq/orders"
+func dsnHasVhost(dsns []string) bool {
+	for _, dsn := range dsns {
+		if u, err := url.Parse(dsn); err == nil && u.Path != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// PipesByConnection groups pipes by RabbitMQ connection they consume messages from,
+// error is returned if pipe references unknown connection
+func PipesByConnection(pipes []Pipe, sources []RabbitConnectionConfig) (map[string][]Pipe, error) {
+	result := make(map[string][]Pipe, len(sources))
+	for _, source := range sources {
+		result[source.Name] = nil
+	}
+
+	for _, pipe := range pipes {
+		connectionPipes, ok := result[pipe.Connection()]
+		if !ok {
+			return nil, fmt.Errorf("pipe for kafka topic %q references unknown rabbit connection %q", pipe.KafkaTopic, pipe.Connection())
+		}
+		result[pipe.Connection()] = append(connectionPipes, pipe)
+	}
+
+	return result, nil
+}
+
+// KafkaClusterConfig contains configuration values for named Kafka cluster
+type KafkaClusterConfig struct {
+	// Name is cluster name pipes reference it by
+	Name string
+	// Kafka overrides global Kafka configuration values, values that are not set are taken
+	// from global configuration. TLS and SASL configurations are overridden as a whole.
+	Kafka KafkaConfig
+}
+
+// KafkaDestinations returns all Kafka clusters pipes can publish messages to: default one configured
+// with "Kafka.Brokers" if they are set, and named ones with global configuration values applied
+func (c GlobalConfig) KafkaDestinations() ([]KafkaClusterConfig, error) {
+	var destinations []KafkaClusterConfig
+	if len(c.Kafka.Brokers) > 0 {
+		destinations = append(destinations, KafkaClusterConfig{Name: DefaultKafkaCluster, Kafka: c.Kafka})
+	}
+
+	names := map[string]bool{DefaultKafkaCluster: true}
+	for _, cluster := range c.KafkaClusters {
+		if cluster.Name == "" {
+			return nil, errors.New("kafka cluster name is required")
+		}
+		if cluster.Name == HTTPDestination {
+			return nil, fmt.Errorf("kafka cluster name %q is reserved for HTTP destination", cluster.Name)
+		}
+		if names[cluster.Name] {
+			return nil, fmt.Errorf("kafka cluster %q is defined more than once", cluster.Name)
+		}
+		if len(cluster.Kafka.Brokers) == 0 {
+			return nil, fmt.Errorf("kafka cluster %q has no brokers", cluster.Name)
+		}
+		names[cluster.Name] = true
+
+		cluster.Kafka = cluster.Kafka.withDefaults(c.Kafka)
+		destinations = append(destinations, cluster)
+	}
+
+	if len(destinations) == 0 {
+		return nil, errors.New("no Kafka cluster is configured")
+	}
+
+	return destinations, nil
+}
+
+func (c KafkaConfig) withDefaults(defaults KafkaConfig) KafkaConfig {
+	if c.MaxRetry == 0 {
+		c.MaxRetry = defaults.MaxRetry
+	}
+	if c.PipesConfig == "" {
+		c.PipesConfig = defaults.PipesConfig
+	}
+	if c.Partitioner == "" {
+		c.Partitioner = defaults.Partitioner
+	}
+	if c.ProducerMode == "" {
+		c.ProducerMode = defaults.ProducerMode
+	}
+	if c.MaxInFlight == 0 {
+		c.MaxInFlight = defaults.MaxInFlight
+	}
+	if c.TLS == (KafkaTLSConfig{}) {
+		c.TLS = defaults.TLS
+	}
+	if c.SASL == (KafkaSASLConfig{}) {
+		c.SASL = defaults.SASL
+	}
+
+	return c
+}
+
+// PipesByDestination returns pipes that publish messages to each Kafka cluster and to HTTP destination,
+// error is returned if pipe references unknown cluster
+func PipesByDestination(pipes []Pipe, destinations []KafkaClusterConfig) (map[string][]Pipe, error) {
+	result := make(map[string][]Pipe, len(destinations)+1)
+	for _, destination := range destinations {
+		result[destination.Name] = nil
+	}
+	result[HTTPDestination] = nil
+
+	for _, pipe := range pipes {
+		for _, cluster := range pipe.Destinations() {
+			clusterPipes, ok := result[cluster]
+			if !ok {
+				return nil, fmt.Errorf("pipe for kafka topic %q references unknown kafka cluster %q", pipe.KafkaTopic, cluster)
+			}
+			result[cluster] = append(clusterPipes, pipe)
+		}
+	}
+
+	return result, nil
+}
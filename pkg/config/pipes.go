@@ -2,12 +2,42 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// Pipe kinds
+const (
+	// PipeKindRabbitToKafka pipe consumes messages from RabbitMQ queue and publishes them to Kafka topic
+	PipeKindRabbitToKafka = "rabbit-to-kafka"
+	// PipeKindKafkaToRabbit pipe consumes messages from Kafka topic and publishes them to RabbitMQ exchange
+	PipeKindKafkaToRabbit = "kafka-to-rabbit"
+
+	// DefaultKafkaConsumerGroup is a Kafka consumer group used by "kafka-to-rabbit" pipes if it is not set
+	DefaultKafkaConsumerGroup = "kandalf"
+)
+
+// Kafka message key sources
+const (
+	// KafkaKeyRoutingKey takes message key from AMQP message routing key
+	KafkaKeyRoutingKey = "routing-key"
+	// KafkaKeyMessageID takes message key from AMQP message ID property
+	KafkaKeyMessageID = "message-id"
+	// KafkaKeyHeaderPrefix takes message key from AMQP message header, e.g. "header:x-customer-id"
+	KafkaKeyHeaderPrefix = "header:"
+	// KafkaKeyJSONPrefix takes message key from JSON message body by dot-separated path, e.g. "json:customer.id"
+	KafkaKeyJSONPrefix = "json:"
+)
+
 // Pipe contains settings for single bridge pipe between Kafka and RabbitMQ
 type Pipe struct {
+	// Kind is a direction of the pipe, one of "rabbit-to-kafka" and "kafka-to-rabbit", default is "rabbit-to-kafka"
+	Kind                    string
 	KafkaTopic              string
 	RabbitExchangeName      string
 	RabbitTransientExchange bool
@@ -15,6 +45,56 @@ type Pipe struct {
 	RabbitQueueName         string
 	RabbitDurableQueue      bool
 	RabbitAutoDeleteQueue   bool
+	// RabbitConnection is the name of RabbitMQ connection to consume messages from or publish messages to,
+	// default one is used if empty
+	RabbitConnection string
+	// RabbitExchangeType is RabbitMQ exchange type, e.g. "direct", "fanout", "topic", "headers"
+	// or plugin provided one like "x-delayed-message", default is "topic"
+	RabbitExchangeType string
+	// RabbitExchangeArgs are optional arguments for exchange declaration, e.g. "x-delayed-type"
+	RabbitExchangeArgs map[string]interface{}
+	// RabbitQueueArgs are optional arguments for queue declaration, e.g. "x-queue-type", "x-message-ttl"
+	// or "x-dead-letter-exchange"
+	RabbitQueueArgs map[string]interface{}
+	// RabbitBindingArgs are optional arguments for queue binding, e.g. "x-match" and headers to match
+	// for "headers" exchange. Queue is bound once with empty routing key if no routing keys are set.
+	RabbitBindingArgs map[string]interface{}
+	// RabbitDeclareMode overrides global RabbitMQ topology declare mode for the pipe,
+	// one of "declare", "passive" and "skip"
+	RabbitDeclareMode string
+	// RabbitPrefetchCount is max number of unacknowledged messages delivered to the pipe, 0 means unlimited
+	RabbitPrefetchCount int
+	// RabbitPrefetchSize is max size in bytes of unacknowledged messages delivered to the pipe, 0 means unlimited.
+	// Note that RabbitMQ does not implement it and closes the channel if it is set.
+	RabbitPrefetchSize int
+	// RabbitConsumers is a number of goroutines handling messages of the pipe in parallel, default is 1
+	RabbitConsumers int
+	// KafkaClusters is a list of names of Kafka clusters to publish messages to, default one is used if empty.
+	// "kafka-to-rabbit" pipe consumes messages from the single cluster set here.
+	KafkaClusters []string
+	// HTTPURL is a URL messages are POSTed to in addition to Kafka clusters, message is not published to Kafka
+	// if it is set and KafkaTopic is empty
+	HTTPURL string
+	// KafkaHeaders is a whitelist of message headers forwarded to Kafka, all headers are forwarded if empty.
+	// Header can be renamed using "<source-name>=<kafka-name>" format.
+	KafkaHeaders []string
+	// KafkaKey is a source of Kafka message key, one of "routing-key", "message-id", "header:<name>"
+	// and "json:<path>", message is sent without key if empty
+	KafkaKey string
+	// KafkaPartition is a Kafka partition message is sent to when "manual" partitioner is used
+	KafkaPartition int32
+	// KafkaConsumerGroup is a Kafka consumer group "kafka-to-rabbit" pipe consumes messages with, default is "kandalf"
+	KafkaConsumerGroup string
+	// RabbitRoutingKeyTemplate is a text/template "kafka-to-rabbit" pipe builds message routing key with,
+	// e.g. "orders.{{ .Headers.country }}". Template gets Topic, Key, Partition, Offset and Headers of Kafka message.
+	// The first of RabbitRoutingKey is used as is if empty.
+	RabbitRoutingKeyTemplate string
+	// BufferSize overrides global max messages number buffered in memory for the pipe topic
+	BufferSize int
+	// BufferFlushTimeout overrides global max amount of time message of the pipe topic is buffered in memory
+	BufferFlushTimeout time.Duration
+	// BufferMaxBytes overrides global max total size of messages bodies buffered in memory for the pipe topic
+	BufferMaxBytes int
 }
 
 func (p Pipe) String() string {
@@ -22,6 +102,179 @@ func (p Pipe) String() string {
 	return string(b)
 }
 
+// KafkaHeadersMapping returns message header name to Kafka record header name mapping,
+// nil is returned if all headers should be forwarded as is
+func (p Pipe) KafkaHeadersMapping() map[string]string {
+	if len(p.KafkaHeaders) == 0 {
+		return nil
+	}
+
+	mapping := make(map[string]string, len(p.KafkaHeaders))
+	for _, header := range p.KafkaHeaders {
+		parts := strings.SplitN(header, "=", 2)
+		if len(parts) == 2 {
+			mapping[parts[0]] = parts[1]
+		} else {
+			mapping[parts[0]] = parts[0]
+		}
+	}
+
+	return mapping
+}
+
+// Direction returns the kind of the pipe, "rabbit-to-kafka" is returned if it is not set
+func (p Pipe) Direction() string {
+	if p.Kind == "" {
+		return PipeKindRabbitToKafka
+	}
+
+	return p.Kind
+}
+
+// ConsumerGroup returns Kafka consumer group "kafka-to-rabbit" pipe consumes messages with
+func (p Pipe) ConsumerGroup() string {
+	if p.KafkaConsumerGroup == "" {
+		return DefaultKafkaConsumerGroup
+	}
+
+	return p.KafkaConsumerGroup
+}
+
+// RoutingKeyTemplate parses routing key template "kafka-to-rabbit" pipe publishes messages with,
+// nil is returned if template is not set
+func (p Pipe) RoutingKeyTemplate() (*template.Template, error) {
+	if p.RabbitRoutingKeyTemplate == "" {
+		return nil, nil
+	}
+
+	return template.New(p.KafkaTopic).Option("missingkey=zero").Parse(p.RabbitRoutingKeyTemplate)
+}
+
+// DeclareMode returns RabbitMQ topology declare mode for the pipe, given default mode is used if it is not set
+func (p Pipe) DeclareMode(defaultMode string) string {
+	if p.RabbitDeclareMode == "" {
+		return defaultMode
+	}
+
+	return p.RabbitDeclareMode
+}
+
+// Connection returns the name of RabbitMQ connection to consume pipe messages from
+func (p Pipe) Connection() string {
+	if p.RabbitConnection == "" {
+		return DefaultRabbitConnection
+	}
+
+	return p.RabbitConnection
+}
+
+// Destinations returns the names of Kafka clusters to publish pipe messages to,
+// HTTP destination is referenced as "http"
+func (p Pipe) Destinations() []string {
+	var destinations []string
+	switch {
+	case len(p.KafkaClusters) > 0:
+		destinations = append(destinations, p.KafkaClusters...)
+	case p.KafkaTopic != "" || p.HTTPURL == "":
+		destinations = append(destinations, DefaultKafkaCluster)
+	}
+
+	if p.HTTPURL != "" {
+		destinations = append(destinations, HTTPDestination)
+	}
+
+	return destinations
+}
+
+// Buffer returns settings of the buffer pipe messages are published from, given defaults are used
+// for the settings that are not overridden
+func (p Pipe) Buffer(defaults BufferConfig) BufferConfig {
+	if p.BufferSize > 0 {
+		defaults.Size = p.BufferSize
+	}
+	if p.BufferFlushTimeout > 0 {
+		defaults.FlushTimeout = p.BufferFlushTimeout
+	}
+	if p.BufferMaxBytes > 0 {
+		defaults.MaxBytes = p.BufferMaxBytes
+	}
+
+	return defaults
+}
+
+// BufferKey returns the name of the buffer pipe messages are published from, buffer is shared by all the pipes
+// of the same Kafka topic, or of the same HTTP URL if pipe does not publish messages to Kafka
+func (p Pipe) BufferKey() string {
+	if p.KafkaTopic == "" {
+		return p.HTTPURL
+	}
+
+	return p.KafkaTopic
+}
+
+// Consumers returns a number of goroutines handling messages of the pipe in parallel
+func (p Pipe) Consumers() int {
+	if p.RabbitConsumers < 1 {
+		return 1
+	}
+
+	return p.RabbitConsumers
+}
+
+func (p Pipe) validate() error {
+	switch p.Direction() {
+	case PipeKindRabbitToKafka:
+	case PipeKindKafkaToRabbit:
+		if p.KafkaTopic == "" {
+			return fmt.Errorf("pipe of kind %q must have kafka topic", p.Kind)
+		}
+		if len(p.KafkaClusters) > 1 {
+			return fmt.Errorf("pipe for kafka topic %q consumes messages from more than one kafka cluster", p.KafkaTopic)
+		}
+		if _, err := p.RoutingKeyTemplate(); err != nil {
+			return fmt.Errorf("pipe for kafka topic %q has invalid rabbit routing key template: %w", p.KafkaTopic, err)
+		}
+		if p.HTTPURL != "" {
+			return fmt.Errorf("pipe for kafka topic %q of kind %q can not publish messages to HTTP URL", p.KafkaTopic, p.Kind)
+		}
+	default:
+		return fmt.Errorf("pipe for kafka topic %q has unknown kind %q", p.KafkaTopic, p.Kind)
+	}
+
+	if p.RabbitPrefetchCount < 0 || p.RabbitPrefetchSize < 0 || p.RabbitConsumers < 0 {
+		return fmt.Errorf("pipe for kafka topic %q has negative rabbit prefetch or consumers settings", p.KafkaTopic)
+	}
+
+	if p.BufferSize < 0 || p.BufferFlushTimeout < 0 || p.BufferMaxBytes < 0 {
+		return fmt.Errorf("pipe for kafka topic %q has negative buffer settings", p.KafkaTopic)
+	}
+
+	if p.HTTPURL != "" {
+		u, err := url.Parse(p.HTTPURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("pipe for rabbit queue %q has invalid HTTP URL %q", p.RabbitQueueName, p.HTTPURL)
+		}
+	}
+
+	switch p.RabbitDeclareMode {
+	case "", DeclareModeDeclare, DeclareModePassive, DeclareModeSkip:
+	default:
+		return fmt.Errorf("pipe for kafka topic %q has unknown rabbit declare mode %q", p.KafkaTopic, p.RabbitDeclareMode)
+	}
+
+	switch {
+	case p.KafkaKey == "",
+		p.KafkaKey == KafkaKeyRoutingKey,
+		p.KafkaKey == KafkaKeyMessageID,
+		strings.HasPrefix(p.KafkaKey, KafkaKeyHeaderPrefix) && len(p.KafkaKey) > len(KafkaKeyHeaderPrefix),
+		strings.HasPrefix(p.KafkaKey, KafkaKeyJSONPrefix) && len(p.KafkaKey) > len(KafkaKeyJSONPrefix):
+	default:
+		return fmt.Errorf("pipe for kafka topic %q has unknown kafka key source %q", p.KafkaTopic, p.KafkaKey)
+	}
+
+	return nil
+}
+
 // LoadPipesFromFile loads pipes config from file
 func LoadPipesFromFile(pipesConfigPath string) ([]Pipe, error) {
 	pipesConfigReader := viper.New()
@@ -38,5 +291,62 @@ func LoadPipesFromFile(pipesConfigPath string) ([]Pipe, error) {
 		return nil, err
 	}
 
+	for _, pipe := range pipes.Pipes {
+		if err := pipe.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validatePipesBuffers(pipes.Pipes); err != nil {
+		return nil, err
+	}
+
 	return pipes.Pipes, nil
 }
+
+// validatePipesBuffers checks that pipes sharing the same buffer do not override its settings differently
+func validatePipesBuffers(pipes []Pipe) error {
+	buffers := make(map[string]Pipe, len(pipes))
+	for _, pipe := range FilterPipes(pipes, PipeKindRabbitToKafka) {
+		bufferPipe, ok := buffers[pipe.BufferKey()]
+		if !ok {
+			buffers[pipe.BufferKey()] = pipe
+			continue
+		}
+
+		if pipe.BufferSize != bufferPipe.BufferSize ||
+			pipe.BufferFlushTimeout != bufferPipe.BufferFlushTimeout ||
+			pipe.BufferMaxBytes != bufferPipe.BufferMaxBytes {
+			return fmt.Errorf("pipes for kafka topic %q have different buffer settings", pipe.KafkaTopic)
+		}
+	}
+
+	return nil
+}
+
+// FilterPipes returns pipes of given kind
+func FilterPipes(pipes []Pipe, kind string) []Pipe {
+	var result []Pipe
+	for _, pipe := range pipes {
+		if pipe.Direction() == kind {
+			result = append(result, pipe)
+		}
+	}
+
+	return result
+}
+
+// PipesTopics returns unique Kafka topics of given pipes in the order they appear
+func PipesTopics(pipes []Pipe) []string {
+	var topics []string
+	seen := make(map[string]bool, len(pipes))
+	for _, pipe := range pipes {
+		if pipe.KafkaTopic == "" || seen[pipe.KafkaTopic] {
+			continue
+		}
+		seen[pipe.KafkaTopic] = true
+		topics = append(topics, pipe.KafkaTopic)
+	}
+
+	return topics
+}
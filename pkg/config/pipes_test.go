@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -37,6 +39,52 @@ func assertPipes(t *testing.T, pipes []Pipe) {
 
 	assert.Equal(t, "missing.transient.exchange", pipes[3].KafkaTopic)
 	assert.Equal(t, false, pipes[3].RabbitTransientExchange)
+
+	assert.Equal(t, []string{"amqp-routing-key", "amqp-correlation-id=correlation-id"}, pipes[0].KafkaHeaders)
+	assert.Nil(t, pipes[1].KafkaHeaders)
+
+	assert.Equal(t, "json:order.customer_id", pipes[0].KafkaKey)
+	assert.Equal(t, "routing-key", pipes[2].KafkaKey)
+	assert.Equal(t, "", pipes[3].KafkaKey)
+
+	assert.Equal(t, "", pipes[0].RabbitExchangeType)
+	assert.Nil(t, pipes[0].RabbitQueueArgs)
+	assert.Equal(t, "payments", pipes[4].KafkaTopic)
+	assert.Equal(t, "headers", pipes[4].RabbitExchangeType)
+	assert.Empty(t, pipes[4].RabbitRoutingKey)
+	assert.Nil(t, pipes[4].RabbitExchangeArgs)
+	assert.Equal(t, map[string]interface{}{
+		"x-queue-type":           "quorum",
+		"x-message-ttl":          86400000,
+		"x-dead-letter-exchange": "payments-dlx",
+	}, pipes[4].RabbitQueueArgs)
+	assert.Equal(t, map[string]interface{}{"x-match": "all", "country": "de"}, pipes[4].RabbitBindingArgs)
+
+	assert.Equal(t, "", pipes[0].RabbitDeclareMode)
+	assert.Equal(t, DeclareModeSkip, pipes[4].RabbitDeclareMode)
+
+	assert.Equal(t, 0, pipes[1].RabbitPrefetchCount)
+	assert.Equal(t, 1, pipes[1].Consumers())
+	assert.Equal(t, 50, pipes[0].RabbitPrefetchCount)
+	assert.Equal(t, 0, pipes[0].RabbitPrefetchSize)
+	assert.Equal(t, 4, pipes[0].Consumers())
+
+	assert.Equal(t, PipeKindRabbitToKafka, pipes[0].Direction())
+	assert.Equal(t, DefaultKafkaConsumerGroup, pipes[0].ConsumerGroup())
+	assert.Equal(t, PipeKindKafkaToRabbit, pipes[5].Direction())
+	assert.Equal(t, "shipments", pipes[5].KafkaTopic)
+	assert.Equal(t, "kandalf-shipments", pipes[5].ConsumerGroup())
+	assert.Equal(t, "logistics", pipes[5].RabbitExchangeName)
+	assert.Equal(t, "shipment.{{ .Headers.country }}.{{ .Headers.event }}", pipes[5].RabbitRoutingKeyTemplate)
+
+	assert.Equal(t, "", pipes[0].HTTPURL)
+	assert.Equal(t, "http://notifications.local/hooks/orders", pipes[6].HTTPURL)
+	assert.Equal(t, []string{HTTPDestination}, pipes[6].Destinations())
+
+	assert.Equal(t, 0, pipes[0].BufferSize)
+	assert.Equal(t, 100, pipes[4].BufferSize)
+	assert.Equal(t, 500*time.Millisecond, pipes[4].BufferFlushTimeout)
+	assert.Equal(t, 262144, pipes[4].BufferMaxBytes)
 }
 
 func TestLoadPipesFromFile(t *testing.T) {
@@ -50,7 +98,7 @@ func TestLoadPipesFromFile(t *testing.T) {
 
 	pipes, err := LoadPipesFromFile(pipesPath)
 	require.NoError(t, err)
-	assert.Len(t, pipes, 4)
+	assert.Len(t, pipes, 7)
 
 	assertPipes(t, pipes)
 }
@@ -78,6 +126,128 @@ func TestLoadPipesFromFile_Error(t *testing.T) {
 	assert.NotEmpty(t, err)
 }
 
+func TestPipe_validate(t *testing.T) {
+	for _, kafkaKey := range []string{"", "routing-key", "message-id", "header:x-customer-id", "json:customer.id"} {
+		assert.NoError(t, Pipe{KafkaKey: kafkaKey}.validate(), kafkaKey)
+	}
+
+	for _, kafkaKey := range []string{"unknown", "header:", "json:"} {
+		assert.Error(t, Pipe{KafkaKey: kafkaKey}.validate(), kafkaKey)
+	}
+
+	for _, declareMode := range []string{"", "declare", "passive", "skip"} {
+		assert.NoError(t, Pipe{RabbitDeclareMode: declareMode}.validate(), declareMode)
+	}
+	assert.Error(t, Pipe{RabbitDeclareMode: "unknown"}.validate())
+
+	assert.Error(t, Pipe{RabbitPrefetchCount: -1}.validate())
+	assert.Error(t, Pipe{RabbitPrefetchSize: -1}.validate())
+	assert.Error(t, Pipe{RabbitConsumers: -1}.validate())
+	assert.Error(t, Pipe{BufferSize: -1}.validate())
+	assert.Error(t, Pipe{BufferFlushTimeout: -time.Second}.validate())
+	assert.Error(t, Pipe{BufferMaxBytes: -1}.validate())
+
+	assert.NoError(t, Pipe{Kind: PipeKindRabbitToKafka}.validate())
+	assert.NoError(t, Pipe{Kind: PipeKindKafkaToRabbit, KafkaTopic: "topic", RabbitRoutingKeyTemplate: "{{ .Key }}"}.validate())
+	assert.Error(t, Pipe{Kind: "unknown"}.validate())
+	assert.Error(t, Pipe{Kind: PipeKindKafkaToRabbit}.validate())
+	assert.Error(t, Pipe{Kind: PipeKindKafkaToRabbit, KafkaTopic: "topic", KafkaClusters: []string{"default", "analytics"}}.validate())
+	assert.Error(t, Pipe{Kind: PipeKindKafkaToRabbit, KafkaTopic: "topic", RabbitRoutingKeyTemplate: "{{ .Key"}.validate())
+	assert.Error(t, Pipe{Kind: PipeKindKafkaToRabbit, KafkaTopic: "topic", HTTPURL: "http://hooks.local"}.validate())
+
+	assert.NoError(t, Pipe{HTTPURL: "https://hooks.local/orders?source=kandalf"}.validate())
+	for _, httpURL := range []string{"hooks.local/orders", "ftp://hooks.local", "http://", "http://hooks.local/%zz"} {
+		assert.Error(t, Pipe{HTTPURL: httpURL}.validate(), httpURL)
+	}
+}
+
+func TestPipe_RoutingKeyTemplate(t *testing.T) {
+	tmpl, err := Pipe{RabbitRoutingKey: []string{"order.created"}}.RoutingKeyTemplate()
+	require.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	tmpl, err = Pipe{RabbitRoutingKeyTemplate: "order.{{ .Headers.country }}.{{ .Headers.event }}"}.RoutingKeyTemplate()
+	require.NoError(t, err)
+
+	var routingKey strings.Builder
+	require.NoError(t, tmpl.Execute(&routingKey, map[string]interface{}{"Headers": map[string]string{"country": "de"}}))
+	assert.Equal(t, "order.de.", routingKey.String())
+}
+
+func TestFilterPipes(t *testing.T) {
+	pipes := []Pipe{{KafkaTopic: "orders"}, {Kind: PipeKindKafkaToRabbit, KafkaTopic: "shipments"}, {Kind: PipeKindRabbitToKafka, KafkaTopic: "users"}}
+
+	assert.Equal(t, []Pipe{pipes[0], pipes[2]}, FilterPipes(pipes, PipeKindRabbitToKafka))
+	assert.Equal(t, []Pipe{pipes[1]}, FilterPipes(pipes, PipeKindKafkaToRabbit))
+}
+
+func TestPipesTopics(t *testing.T) {
+	pipes := []Pipe{{KafkaTopic: "orders"}, {HTTPURL: "http://hooks.local"}, {KafkaTopic: "users"}, {KafkaTopic: "orders"}}
+
+	assert.Equal(t, []string{"orders", "users"}, PipesTopics(pipes))
+	assert.Nil(t, PipesTopics(nil))
+}
+
+func TestPipe_Connection(t *testing.T) {
+	assert.Equal(t, DefaultRabbitConnection, Pipe{}.Connection())
+	assert.Equal(t, "legacy", Pipe{RabbitConnection: "legacy"}.Connection())
+}
+
+func TestPipe_Destinations(t *testing.T) {
+	assert.Equal(t, []string{DefaultKafkaCluster}, Pipe{}.Destinations())
+	assert.Equal(t, []string{"regional", "analytics"}, Pipe{KafkaClusters: []string{"regional", "analytics"}}.Destinations())
+	assert.Equal(t, []string{HTTPDestination}, Pipe{HTTPURL: "http://hooks.local"}.Destinations())
+	assert.Equal(t, []string{DefaultKafkaCluster, HTTPDestination}, Pipe{KafkaTopic: "orders", HTTPURL: "http://hooks.local"}.Destinations())
+	assert.Equal(t, []string{"analytics", HTTPDestination}, Pipe{KafkaClusters: []string{"analytics"}, HTTPURL: "http://hooks.local"}.Destinations())
+}
+
+func TestPipe_Buffer(t *testing.T) {
+	defaults := BufferConfig{Size: 10, FlushTimeout: 5 * time.Second}
+
+	assert.Equal(t, defaults, Pipe{}.Buffer(defaults))
+	assert.Equal(t,
+		BufferConfig{Size: 100, FlushTimeout: 500 * time.Millisecond, MaxBytes: 1024},
+		Pipe{BufferSize: 100, BufferFlushTimeout: 500 * time.Millisecond, BufferMaxBytes: 1024}.Buffer(defaults),
+	)
+}
+
+func TestPipe_BufferKey(t *testing.T) {
+	assert.Equal(t, "orders", Pipe{KafkaTopic: "orders"}.BufferKey())
+	assert.Equal(t, "orders", Pipe{KafkaTopic: "orders", HTTPURL: "http://hooks.local"}.BufferKey())
+	assert.Equal(t, "http://hooks.local", Pipe{HTTPURL: "http://hooks.local"}.BufferKey())
+}
+
+func TestValidatePipesBuffers(t *testing.T) {
+	assert.NoError(t, validatePipesBuffers([]Pipe{
+		{KafkaTopic: "orders", RabbitQueueName: "orders-created", BufferSize: 100},
+		{KafkaTopic: "orders", RabbitQueueName: "orders-updated", BufferSize: 100},
+		{KafkaTopic: "payments", BufferSize: 1},
+		// "kafka-to-rabbit" pipes are not buffered
+		{Kind: PipeKindKafkaToRabbit, KafkaTopic: "orders"},
+	}))
+
+	assert.Error(t, validatePipesBuffers([]Pipe{
+		{KafkaTopic: "orders", RabbitQueueName: "orders-created", BufferSize: 100},
+		{KafkaTopic: "orders", RabbitQueueName: "orders-updated"},
+	}))
+}
+
+func TestPipe_DeclareMode(t *testing.T) {
+	assert.Equal(t, DeclareModePassive, Pipe{}.DeclareMode(DeclareModePassive))
+	assert.Equal(t, DeclareModeSkip, Pipe{RabbitDeclareMode: DeclareModeSkip}.DeclareMode(DeclareModePassive))
+}
+
+func TestPipe_KafkaHeadersMapping(t *testing.T) {
+	pipe := Pipe{}
+	assert.Nil(t, pipe.KafkaHeadersMapping())
+
+	pipe.KafkaHeaders = []string{"amqp-routing-key", "amqp-correlation-id=correlation-id"}
+	assert.Equal(t, map[string]string{
+		"amqp-routing-key":    "amqp-routing-key",
+		"amqp-correlation-id": "correlation-id",
+	}, pipe.KafkaHeadersMapping())
+}
+
 func TestPipe_String(t *testing.T) {
 	pipe := Pipe{
 		KafkaTopic:              "topic",
@@ -88,7 +258,7 @@ func TestPipe_String(t *testing.T) {
 		RabbitDurableQueue:      true,
 		RabbitAutoDeleteQueue:   false,
 	}
-	pipeJSON := `{"KafkaTopic":"topic","RabbitExchangeName":"rqExchange","RabbitTransientExchange":false,"RabbitRoutingKey":["rqKey"],"RabbitQueueName":"rqQueue","RabbitDurableQueue":true,"RabbitAutoDeleteQueue":false}`
+	pipeJSON := `{"Kind":"","KafkaTopic":"topic","RabbitExchangeName":"rqExchange","RabbitTransientExchange":false,"RabbitRoutingKey":["rqKey"],"RabbitQueueName":"rqQueue","RabbitDurableQueue":true,"RabbitAutoDeleteQueue":false,"RabbitConnection":"","RabbitExchangeType":"","RabbitExchangeArgs":null,"RabbitQueueArgs":null,"RabbitBindingArgs":null,"RabbitDeclareMode":"","RabbitPrefetchCount":0,"RabbitPrefetchSize":0,"RabbitConsumers":0,"KafkaClusters":null,"HTTPURL":"","KafkaHeaders":null,"KafkaKey":"","KafkaPartition":0,"KafkaConsumerGroup":"","RabbitRoutingKeyTemplate":"","BufferSize":0,"BufferFlushTimeout":0,"BufferMaxBytes":0}`
 
 	assert.Equal(t, pipeJSON, pipe.String())
 	assert.Equal(t, pipeJSON, fmt.Sprintf("%s", pipe))
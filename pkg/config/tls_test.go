@@ -0,0 +1,80 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate generates self-signed certificate and writes it with its key to PEM files
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kandalf"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600))
+
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	tlsConfig, err := newTLSConfig(certFile, certFile, keyFile, "kafka.local", false)
+	require.NoError(t, err)
+	assert.Equal(t, "kafka.local", tlsConfig.ServerName)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+
+	tlsConfig, err = newTLSConfig("", "", "", "", true)
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig.RootCAs)
+	assert.Empty(t, tlsConfig.Certificates)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+}
+
+func TestNewTLSConfig_errors(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	_, err := newTLSConfig(filepath.Join(t.TempDir(), "does-not-exist.pem"), "", "", "", false)
+	assert.Error(t, err)
+
+	// key file is not a certificate
+	_, err = newTLSConfig(keyFile, "", "", "", false)
+	assert.Error(t, err)
+
+	_, err = newTLSConfig("", certFile, "", "", false)
+	assert.Error(t, err)
+
+	_, err = newTLSConfig("", certFile, certFile, "", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,4 @@
+/*
+Package health holds code required for reporting state of application components over HTTP.
+*/
+package health
@@ -0,0 +1,117 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// StatusUp is the status of the component that works as expected
+	StatusUp = "up"
+	// StatusDegraded is the status of the component that does not work as expected, but is able to recover,
+	// e.g. connection that is being re-established
+	StatusDegraded = "degraded"
+	// StatusDown is the status of the component that is not able to recover
+	StatusDown = "down"
+)
+
+// Component is a health report of application component
+type Component struct {
+	Status  string                 `json:"status"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is a health report of all the application components
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// CheckFunc is a function type that reports health of application component
+type CheckFunc func() Component
+
+// Checker collects health reports of application components
+type Checker struct {
+	mu     sync.RWMutex
+	checks map[string]CheckFunc
+}
+
+// NewChecker instantiates new health checker without components
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[string]CheckFunc)}
+}
+
+// Add registers check of the component with given name, check of the component with the same name is replaced
+func (c *Checker) Add(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[name] = check
+}
+
+// Check reports health of all the components, report status is the worst status of the components
+func (c *Checker) Check() Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	report := Report{Status: StatusUp, Components: make(map[string]Component, len(c.checks))}
+	for name, check := range c.checks {
+		component := check()
+		report.Components[name] = component
+
+		if component.Status == StatusDown || (component.Status == StatusDegraded && report.Status == StatusUp) {
+			report.Status = component.Status
+		}
+	}
+
+	return report
+}
+
+// LivenessHandler responds with health report, request fails only if some of the components is down
+// and application is not able to recover without restart
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check()
+		writeReport(w, report, report.Status != StatusDown)
+	})
+}
+
+// ReadinessHandler responds with health report, request fails if any of the components is not up
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check()
+		writeReport(w, report, report.Status == StatusUp)
+	})
+}
+
+func writeReport(w http.ResponseWriter, report Report, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.WithError(err).Error("Failed to write health report")
+	}
+}
+
+// Up returns report of the component that works as expected
+func Up(details map[string]interface{}) Component {
+	return Component{Status: StatusUp, Details: details}
+}
+
+// Degraded returns report of the component that failed with given error, but is able to recover
+func Degraded(err error, details map[string]interface{}) Component {
+	component := Component{Status: StatusDegraded, Details: details}
+	if err != nil {
+		component.Error = err.Error()
+	}
+
+	return component
+}
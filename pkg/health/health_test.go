@@ -0,0 +1,69 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checkReturning(component Component) CheckFunc {
+	return func() Component {
+		return component
+	}
+}
+
+func TestChecker_Check(t *testing.T) {
+	checker := NewChecker()
+	assert.Equal(t, Report{Status: StatusUp, Components: map[string]Component{}}, checker.Check())
+
+	checker.Add("amqp.default", checkReturning(Up(map[string]interface{}{"state": "connected"})))
+	checker.Add("kafka.default", checkReturning(Degraded(errors.New("no brokers"), nil)))
+	report := checker.Check()
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, StatusUp, report.Components["amqp.default"].Status)
+	assert.Equal(t, "no brokers", report.Components["kafka.default"].Error)
+
+	// down component makes the whole report down no matter the order of checks
+	checker.Add("amqp.default", checkReturning(Component{Status: StatusDown}))
+	assert.Equal(t, StatusDown, checker.Check().Status)
+}
+
+func TestChecker_handlers(t *testing.T) {
+	checker := NewChecker()
+	checker.Add("amqp.default", checkReturning(Up(nil)))
+
+	for _, tc := range []struct {
+		name      string
+		component Component
+		liveness  int
+		readiness int
+	}{
+		{"up", Up(nil), http.StatusOK, http.StatusOK},
+		{"degraded", Degraded(nil, nil), http.StatusOK, http.StatusServiceUnavailable},
+		{"down", Component{Status: StatusDown}, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			checker.Add("kafka.default", checkReturning(tc.component))
+
+			handlers := []http.Handler{checker.LivenessHandler(), checker.ReadinessHandler()}
+			codes := []int{tc.liveness, tc.readiness}
+			for i, handler := range handlers {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+				assert.Equal(t, codes[i], w.Code)
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+				var report Report
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+				assert.Equal(t, tc.component.Status, report.Status)
+				assert.Len(t, report.Components, 2)
+			}
+		})
+	}
+}
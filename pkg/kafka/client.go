@@ -0,0 +1,47 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+// NewClientConfig instantiates Kafka client config with connection settings, e.g. TLS and SASL
+func NewClientConfig(kafkaConfig config.KafkaConfig) (*sarama.Config, error) {
+	cnf := sarama.NewConfig()
+
+	if kafkaConfig.TLS.Enabled {
+		tlsConfig, err := kafkaConfig.TLS.Config()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure kafka TLS: %w", err)
+		}
+		cnf.Net.TLS.Enable = true
+		cnf.Net.TLS.Config = tlsConfig
+	}
+
+	if kafkaConfig.SASL.Enabled {
+		cnf.Net.SASL.Enable = true
+		cnf.Net.SASL.Handshake = true
+		cnf.Net.SASL.User = kafkaConfig.SASL.User
+		cnf.Net.SASL.Password = kafkaConfig.SASL.Password
+
+		switch kafkaConfig.SASL.Mechanism {
+		case "", sarama.SASLTypePlaintext:
+			cnf.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			cnf.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			cnf.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newSCRAMClient(sha256.New) }
+		case sarama.SASLTypeSCRAMSHA512:
+			cnf.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			cnf.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newSCRAMClient(sha512.New) }
+		default:
+			return nil, fmt.Errorf("unknown kafka SASL mechanism %q", kafkaConfig.SASL.Mechanism)
+		}
+	}
+
+	return cnf, nil
+}
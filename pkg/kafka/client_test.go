@@ -0,0 +1,39 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+func TestNewClientConfig(t *testing.T) {
+	cnf, err := NewClientConfig(config.KafkaConfig{})
+	require.NoError(t, err)
+	assert.False(t, cnf.Net.TLS.Enable)
+	assert.False(t, cnf.Net.SASL.Enable)
+
+	cnf, err = NewClientConfig(config.KafkaConfig{
+		TLS:  config.KafkaTLSConfig{Enabled: true, ServerName: "kafka.local", InsecureSkipVerify: true},
+		SASL: config.KafkaSASLConfig{Enabled: true, Mechanism: "SCRAM-SHA-512", User: "user", Password: "pencil"},
+	})
+	require.NoError(t, err)
+	assert.True(t, cnf.Net.TLS.Enable)
+	assert.Equal(t, "kafka.local", cnf.Net.TLS.Config.ServerName)
+	assert.True(t, cnf.Net.TLS.Config.InsecureSkipVerify)
+	assert.True(t, cnf.Net.SASL.Enable)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), cnf.Net.SASL.Mechanism)
+	assert.Equal(t, "user", cnf.Net.SASL.User)
+	assert.Equal(t, "pencil", cnf.Net.SASL.Password)
+	assert.NotNil(t, cnf.Net.SASL.SCRAMClientGeneratorFunc)
+	assert.NoError(t, cnf.Validate())
+
+	_, err = NewClientConfig(config.KafkaConfig{SASL: config.KafkaSASLConfig{Enabled: true, Mechanism: "GSSAPI"}})
+	assert.Error(t, err)
+
+	_, err = NewClientConfig(config.KafkaConfig{TLS: config.KafkaTLSConfig{Enabled: true, CAFile: "does-not-exist.pem"}})
+	assert.Error(t, err)
+}
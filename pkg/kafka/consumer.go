@@ -0,0 +1,226 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/hellofresh/stats-go/bucket"
+	"github.com/hellofresh/stats-go/client"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+const (
+	statsKafkaSection = "kafka"
+	statsOpConsume    = "consume"
+
+	consumeRetryInterval        = time.Second
+	publishRetryInitialInterval = 100 * time.Millisecond
+	publishRetryMaxInterval     = 10 * time.Second
+)
+
+// Message is a message consumed from Kafka
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Body      []byte
+	Headers   map[string]string
+	Timestamp time.Time
+}
+
+// Publisher publishes messages consumed from Kafka, nil is returned only when message is confirmed by the broker
+type Publisher interface {
+	Publish(exchange, routingKey string, msg Message) error
+}
+
+// Consumer consumes messages of a single "kafka-to-rabbit" pipe using Kafka consumer group
+// and publishes them to RabbitMQ exchange. Message offset is committed only after the message is confirmed.
+type Consumer struct {
+	group       sarama.ConsumerGroup
+	pipe        config.Pipe
+	routingKey  *template.Template
+	publisher   Publisher
+	statsClient client.Client
+}
+
+// NewConsumer instantiates new Kafka consumer group member for the pipe
+func NewConsumer(kafkaConfig config.KafkaConfig, pipe config.Pipe, publisher Publisher, statsClient client.Client) (*Consumer, error) {
+	cnf, err := NewClientConfig(kafkaConfig)
+	if err != nil {
+		return nil, err
+	}
+	cnf.Consumer.Return.Errors = true
+	// only marked offsets are committed, messages are marked after they are confirmed by RabbitMQ
+	cnf.Consumer.Offsets.AutoCommit.Enable = true
+
+	group, err := sarama.NewConsumerGroup(kafkaConfig.Brokers, pipe.ConsumerGroup(), cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConsumer(group, pipe, publisher, statsClient)
+}
+
+func newConsumer(group sarama.ConsumerGroup, pipe config.Pipe, publisher Publisher, statsClient client.Client) (*Consumer, error) {
+	routingKey, err := pipe.RoutingKeyTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Consumer{
+		group:       group,
+		pipe:        pipe,
+		routingKey:  routingKey,
+		publisher:   publisher,
+		statsClient: statsClient,
+	}, nil
+}
+
+// Go starts consuming messages until context is cancelled
+func (c *Consumer) Go(ctx context.Context) {
+	go func() {
+		for err := range c.group.Errors() {
+			log.WithError(err).WithField("pipe", c.pipe.String()).Error("Got error from Kafka consumer group")
+		}
+	}()
+
+	go func() {
+		for {
+			// Consume returns when group is rebalanced, so it is called again to get new claims
+			err := c.group.Consume(ctx, []string{c.pipe.KafkaTopic}, c)
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			if err != nil {
+				log.WithError(err).WithField("pipe", c.pipe.String()).Error("Failed to consume Kafka messages")
+
+				select {
+				case <-ctx.Done():
+				case <-time.After(consumeRetryInterval):
+				}
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Close leaves Kafka consumer group
+func (c *Consumer) Close() error {
+	return c.group.Close()
+}
+
+// Setup is run at the beginning of a new consumer group session
+func (c *Consumer) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup is run at the end of a consumer group session
+func (c *Consumer) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim publishes messages of a claimed partition one by one, so their order is kept
+func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if err := c.handle(session.Context(), msg); err != nil {
+			// session is over, message is not marked so it is consumed again by the next partition owner
+			return nil
+		}
+		session.MarkMessage(msg, "")
+	}
+
+	return nil
+}
+
+// handle publishes message retrying until it is confirmed or context is done
+func (c *Consumer) handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	message := newMessage(msg)
+	operation := bucket.NewMetricOperation(statsOpConsume, msg.Topic)
+
+	routingKey, err := c.messageRoutingKey(message)
+	if err != nil {
+		// template fails the same way on every attempt, so message is skipped to not block the partition
+		c.statsClient.TrackOperation(statsKafkaSection, operation, nil, false)
+		log.WithError(err).WithField("pipe", c.pipe.String()).WithField("offset", msg.Offset).
+			Error("Failed to build routing key, skipping Kafka message")
+		return nil
+	}
+
+	interval := publishRetryInitialInterval
+	for {
+		err := c.publisher.Publish(c.pipe.RabbitExchangeName, routingKey, message)
+		c.statsClient.TrackOperation(statsKafkaSection, operation, nil, nil == err)
+		if err == nil {
+			return nil
+		}
+
+		log.WithError(err).WithField("pipe", c.pipe.String()).WithField("offset", msg.Offset).
+			Warn("Failed to publish Kafka message to AMQP, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > publishRetryMaxInterval {
+			interval = publishRetryMaxInterval
+		}
+	}
+}
+
+func (c *Consumer) messageRoutingKey(msg Message) (string, error) {
+	if c.routingKey == nil {
+		if len(c.pipe.RabbitRoutingKey) == 0 {
+			return "", nil
+		}
+		return c.pipe.RabbitRoutingKey[0], nil
+	}
+
+	var routingKey strings.Builder
+	err := c.routingKey.Execute(&routingKey, struct {
+		Topic     string
+		Key       string
+		Partition int32
+		Offset    int64
+		Headers   map[string]string
+	}{
+		Topic:     msg.Topic,
+		Key:       string(msg.Key),
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Headers:   msg.Headers,
+	})
+
+	return routingKey.String(), err
+}
+
+func newMessage(msg *sarama.ConsumerMessage) Message {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, header := range msg.Headers {
+		if header != nil {
+			headers[string(header.Key)] = string(header.Value)
+		}
+	}
+
+	return Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Body:      msg.Value,
+		Headers:   headers,
+		Timestamp: msg.Timestamp,
+	}
+}
@@ -0,0 +1,153 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/hellofresh/stats-go"
+	"github.com/hellofresh/stats-go/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+type publishedMessage struct {
+	exchange   string
+	routingKey string
+	msg        Message
+}
+
+type mockPublisher struct {
+	failures  int
+	published []publishedMessage
+}
+
+func (p *mockPublisher) Publish(exchange, routingKey string, msg Message) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("not confirmed")
+	}
+
+	p.published = append(p.published, publishedMessage{exchange, routingKey, msg})
+	return nil
+}
+
+type mockSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *mockSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *mockSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type mockClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *mockClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func newMockClaim(messages ...*sarama.ConsumerMessage) *mockClaim {
+	claim := &mockClaim{messages: make(chan *sarama.ConsumerMessage, len(messages))}
+	for _, msg := range messages {
+		claim.messages <- msg
+	}
+	close(claim.messages)
+
+	return claim
+}
+
+func TestConsumer_ConsumeClaim(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	publisher := &mockPublisher{failures: 1}
+	pipe := config.Pipe{
+		Kind:                     config.PipeKindKafkaToRabbit,
+		KafkaTopic:               "shipments",
+		RabbitExchangeName:       "logistics",
+		RabbitRoutingKeyTemplate: "shipment.{{ .Headers.country }}.{{ .Key }}.{{ .Headers.missing }}",
+	}
+
+	consumer, err := newConsumer(nil, pipe, publisher, statsClient)
+	require.NoError(t, err)
+
+	session := &mockSession{ctx: context.Background()}
+	claim := newMockClaim(
+		&sarama.ConsumerMessage{
+			Topic:   "shipments",
+			Offset:  10,
+			Key:     []byte("created"),
+			Value:   []byte("body"),
+			Headers: []*sarama.RecordHeader{{Key: []byte("country"), Value: []byte("de")}},
+		},
+		&sarama.ConsumerMessage{Topic: "shipments", Offset: 11, Key: []byte("sent")},
+	)
+
+	require.NoError(t, consumer.ConsumeClaim(session, claim))
+	assert.Equal(t, []int64{10, 11}, session.marked)
+
+	require.Len(t, publisher.published, 2)
+	assert.Equal(t, "logistics", publisher.published[0].exchange)
+	assert.Equal(t, "shipment.de.created.", publisher.published[0].routingKey)
+	assert.Equal(t, []byte("body"), publisher.published[0].msg.Body)
+	assert.Equal(t, map[string]string{"country": "de"}, publisher.published[0].msg.Headers)
+	assert.Equal(t, "shipment..sent.", publisher.published[1].routingKey)
+
+	memoryStats, _ := statsClient.(*client.Memory)
+	assert.Equal(t, 2, memoryStats.CountMetrics["kafka-ok.consume.shipments.-"])
+	assert.Equal(t, 1, memoryStats.CountMetrics["kafka-fail.consume.shipments.-"])
+}
+
+func TestConsumer_ConsumeClaim_sessionDone(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	publisher := &mockPublisher{failures: 100}
+	pipe := config.Pipe{Kind: config.PipeKindKafkaToRabbit, KafkaTopic: "shipments", RabbitRoutingKey: []string{"shipment"}}
+
+	consumer, err := newConsumer(nil, pipe, publisher, statsClient)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	session := &mockSession{ctx: ctx}
+	claim := newMockClaim(&sarama.ConsumerMessage{Topic: "shipments", Offset: 10})
+
+	require.NoError(t, consumer.ConsumeClaim(session, claim))
+	// message is not confirmed, so its offset must not be committed
+	assert.Empty(t, session.marked)
+	assert.Empty(t, publisher.published)
+}
+
+func TestConsumer_messageRoutingKey(t *testing.T) {
+	consumer, err := newConsumer(nil, config.Pipe{RabbitRoutingKey: []string{"order.created", "order.updated"}}, nil, nil)
+	require.NoError(t, err)
+	routingKey, err := consumer.messageRoutingKey(Message{})
+	require.NoError(t, err)
+	assert.Equal(t, "order.created", routingKey)
+
+	consumer, err = newConsumer(nil, config.Pipe{}, nil, nil)
+	require.NoError(t, err)
+	routingKey, err = consumer.messageRoutingKey(Message{})
+	require.NoError(t, err)
+	assert.Equal(t, "", routingKey)
+
+	consumer, err = newConsumer(nil, config.Pipe{RabbitRoutingKeyTemplate: "{{ .Topic }}.{{ .Partition }}.{{ .Offset }}"}, nil, nil)
+	require.NoError(t, err)
+	routingKey, err = consumer.messageRoutingKey(Message{Topic: "orders", Partition: 2, Offset: 42})
+	require.NoError(t, err)
+	assert.Equal(t, "orders.2.42", routingKey)
+
+	_, err = newConsumer(nil, config.Pipe{RabbitRoutingKeyTemplate: "{{ .Topic"}, nil, nil)
+	assert.Error(t, err)
+}
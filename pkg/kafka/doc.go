@@ -0,0 +1,5 @@
+/*
+Package kafka holds Kafka client settings shared by producer and consumer and
+implementation for consuming messages from Kafka.
+*/
+package kafka
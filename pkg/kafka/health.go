@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/health"
+)
+
+// healthCheckInterval is how often cluster metadata is refreshed by health check
+const healthCheckInterval = 10 * time.Second
+
+var errNotChecked = errors.New("kafka cluster is not checked yet")
+
+// HealthCheck checks that Kafka cluster is reachable by refreshing metadata of the topics pipes publish to.
+// Metadata is refreshed in background, so health probes get the last result right away and do not wait
+// for metadata request retries while brokers are slow.
+type HealthCheck struct {
+	client sarama.Client
+	topics []string
+
+	mu   sync.RWMutex
+	last health.Component
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewHealthCheck instantiates Kafka cluster health check, check uses its own connection,
+// so it does not interfere with publishing
+func NewHealthCheck(kafkaConfig config.KafkaConfig, topics []string) (*HealthCheck, error) {
+	cnf, err := NewClientConfig(kafkaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sarama.NewClient(kafkaConfig.Brokers, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	return newHealthCheck(client, topics, healthCheckInterval), nil
+}
+
+func newHealthCheck(client sarama.Client, topics []string, interval time.Duration) *HealthCheck {
+	h := &HealthCheck{
+		client: client,
+		topics: topics,
+		last:   health.Degraded(errNotChecked, nil),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(h.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			h.refresh()
+
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return h
+}
+
+// Health reports cluster brokers as of the last metadata refresh, cluster is degraded if topics metadata
+// can not be refreshed
+func (h *HealthCheck) Health() health.Component {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.last
+}
+
+func (h *HealthCheck) refresh() {
+	err := h.client.RefreshMetadata(h.topics...)
+
+	brokers := h.client.Brokers()
+	var connected int
+	for _, broker := range brokers {
+		if ok, _ := broker.Connected(); ok {
+			connected++
+		}
+	}
+
+	details := map[string]interface{}{"brokers": len(brokers), "connected": connected}
+	component := health.Up(details)
+	if err != nil {
+		component = health.Degraded(err, details)
+	}
+
+	h.mu.Lock()
+	h.last = component
+	h.mu.Unlock()
+}
+
+// Close stops refreshing metadata and closes health check Kafka connection
+func (h *HealthCheck) Close() error {
+	close(h.stop)
+	<-h.done
+
+	return h.client.Close()
+}
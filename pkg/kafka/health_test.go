@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/health"
+)
+
+func TestHealthCheck_Health(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()),
+	})
+
+	cnf := sarama.NewConfig()
+	cnf.Metadata.Retry.Max = 0
+	cnf.Metadata.Retry.Backoff = time.Millisecond
+	client, err := sarama.NewClient([]string{broker.Addr()}, cnf)
+	require.NoError(t, err)
+
+	check := newHealthCheck(client, []string{"orders"}, 10*time.Millisecond)
+	defer check.Close()
+
+	// result of the last refresh is reported without waiting for metadata
+	require.Eventually(t, func() bool {
+		return check.Health().Status == health.StatusUp
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, check.Health().Details["brokers"])
+
+	// cluster is not reachable anymore
+	broker.Close()
+	require.Eventually(t, func() bool {
+		return check.Health().Status == health.StatusDegraded
+	}, time.Second, 5*time.Millisecond)
+	assert.NotEmpty(t, check.Health().Error)
+}
+
+func TestHealthCheck_Health_notChecked(t *testing.T) {
+	check := &HealthCheck{last: health.Degraded(errNotChecked, nil)}
+
+	component := check.Health()
+	assert.Equal(t, health.StatusDegraded, component.Status)
+	assert.Equal(t, errNotChecked.Error(), component.Error)
+}
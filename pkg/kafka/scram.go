@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"github.com/xdg-go/scram"
+)
+
+// scramClient is a SCRAM client used by Kafka client for SCRAM-SHA-256 and SCRAM-SHA-512 SASL mechanisms,
+// it is the same as the one from sarama examples
+type scramClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+
+	// nonceGenerator replaces random client nonce in tests
+	nonceGenerator scram.NonceGeneratorFcn
+}
+
+func newSCRAMClient(hashGeneratorFcn scram.HashGeneratorFcn) *scramClient {
+	return &scramClient{HashGeneratorFcn: hashGeneratorFcn}
+}
+
+// Begin prepares the client for the SCRAM exchange
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	if c.nonceGenerator != nil {
+		client = client.WithNonceGenerator(c.nonceGenerator)
+	}
+
+	c.Client = client
+	c.ClientConversation = client.NewConversation()
+	return nil
+}
+
+// Step takes a string provided from a server and returns a response for the next server challenge
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.ClientConversation.Step(challenge)
+}
+
+// Done returns true when the SCRAM exchange is finished
+func (c *scramClient) Done() bool {
+	return c.ClientConversation.Done()
+}
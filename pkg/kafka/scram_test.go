@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCRAMClient(t *testing.T) {
+	// test vector from RFC 7677
+	client := newSCRAMClient(sha256.New)
+	client.nonceGenerator = func() string { return "rOprNGfwEbeRWgbNEkqO" }
+
+	require.NoError(t, client.Begin("user", "pencil", ""))
+
+	clientFirst, err := client.Step("")
+	require.NoError(t, err)
+	assert.Equal(t, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", clientFirst)
+	assert.False(t, client.Done())
+
+	clientFinal, err := client.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	require.NoError(t, err)
+	assert.Equal(t, "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", clientFinal)
+	assert.False(t, client.Done())
+
+	_, err = client.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")
+	require.NoError(t, err)
+	assert.True(t, client.Done())
+}
+
+func TestSCRAMClient_errors(t *testing.T) {
+	client := newSCRAMClient(sha256.New)
+	client.nonceGenerator = func() string { return "rOprNGfwEbeRWgbNEkqO" }
+	require.NoError(t, client.Begin("user", "pencil", ""))
+
+	_, err := client.Step("")
+	require.NoError(t, err)
+
+	_, err = client.Step("r=forged-nonce,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.Error(t, err)
+
+	require.NoError(t, client.Begin("user", "pencil", ""))
+	_, err = client.Step("")
+	require.NoError(t, err)
+	_, err = client.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	require.NoError(t, err)
+
+	_, err = client.Step("e=invalid-proof")
+	assert.Error(t, err)
+	assert.False(t, client.Valid())
+}
+
+func TestSCRAMClient_Begin_nonce(t *testing.T) {
+	client := newSCRAMClient(sha256.New)
+
+	require.NoError(t, client.Begin("user", "pencil", ""))
+	first, err := client.Step("")
+	require.NoError(t, err)
+
+	require.NoError(t, client.Begin("user", "pencil", ""))
+	second, err := client.Step("")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+}
@@ -0,0 +1,183 @@
+package producer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hellofresh/stats-go/bucket"
+	"github.com/hellofresh/stats-go/client"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+const (
+	statsHTTPSection = "http"
+
+	// HeaderHTTPMessageID is the name of HTTP request header that holds message ID,
+	// it is the same for all the attempts to deliver the message, so receiver can deduplicate them
+	HeaderHTTPMessageID = "X-Kandalf-Message-Id"
+)
+
+var errNoMessageURL = errors.New("message has no HTTP URL")
+
+// HTTPProducer is a Producer implementation for POSTing messages to HTTP destinations, e.g. webhooks
+type HTTPProducer struct {
+	httpClient   *http.Client
+	httpConfig   config.HTTPConfig
+	successCodes statusCodes
+	retryCodes   statusCodes
+	statsClient  client.Client
+}
+
+// NewHTTPProducer instantiates new HTTP producer
+func NewHTTPProducer(httpConfig config.HTTPConfig, statsClient client.Client) (Producer, error) {
+	if len(httpConfig.SuccessCodes) == 0 {
+		httpConfig.SuccessCodes = []string{"2xx"}
+	}
+
+	successCodes, err := newStatusCodes(httpConfig.SuccessCodes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP success codes: %w", err)
+	}
+
+	retryCodes, err := newStatusCodes(httpConfig.RetryCodes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP retry codes: %w", err)
+	}
+
+	return &HTTPProducer{
+		httpClient:   &http.Client{Timeout: httpConfig.Timeout},
+		httpConfig:   httpConfig,
+		successCodes: successCodes,
+		retryCodes:   retryCodes,
+		statsClient:  statsClient,
+	}, nil
+}
+
+// Close closes idle HTTP connections
+func (p *HTTPProducer) Close() error {
+	p.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// Publish POSTs message to its URL, request is retried on network errors and retry response codes
+func (p *HTTPProducer) Publish(msg Message) error {
+	if msg.URL == "" {
+		return errNoMessageURL
+	}
+
+	host := msg.URL
+	if u, err := url.Parse(msg.URL); err == nil {
+		host = u.Host
+	}
+
+	interval := p.httpConfig.RetryInterval
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = p.post(msg)
+		if err == nil || !retry || attempt >= p.httpConfig.MaxRetry {
+			break
+		}
+
+		log.WithError(err).WithField("msg", msg.String()).Debug("Failed to POST message, retrying")
+		time.Sleep(interval)
+		interval *= 2
+	}
+
+	if err == nil {
+		log.WithField("msg", msg.String()).Debug("Successfully sent message to HTTP destination")
+	} else {
+		log.WithError(err).WithField("msg", msg.String()).Error("Failed to publish message to HTTP destination")
+	}
+	operation := bucket.NewMetricOperation("publish", host)
+	p.statsClient.TrackOperation(statsHTTPSection, operation, nil, err == nil)
+
+	return err
+}
+
+// PublishBatch POSTs messages one by one, as HTTP destination accepts single message per request
+func (p *HTTPProducer) PublishBatch(messages []Message) error {
+	batchErr := &BatchError{Errors: make(map[int]error)}
+	for i, msg := range messages {
+		if err := p.Publish(msg); err != nil {
+			batchErr.Errors[i] = err
+		}
+	}
+
+	if len(batchErr.Errors) == 0 {
+		return nil
+	}
+	return batchErr
+}
+
+// post sends single request and returns whether it can be retried if it failed
+func (p *HTTPProducer) post(msg Message) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, msg.URL, bytes.NewReader(msg.Body))
+	if err != nil {
+		return false, err
+	}
+
+	for name, value := range msg.Headers {
+		req.Header.Set(name, value)
+	}
+	if contentType, ok := msg.Headers[HeaderContentType]; ok {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set(HeaderHTTPMessageID, msg.ID.String())
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	// drain body so connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if p.successCodes.match(resp.StatusCode) {
+		return false, nil
+	}
+
+	err = fmt.Errorf("HTTP destination responded with %d status code", resp.StatusCode)
+	return p.retryCodes.match(resp.StatusCode), err
+}
+
+// statusCodes is a list of HTTP response codes or code classes, e.g. "404" or "5xx"
+type statusCodes []string
+
+func newStatusCodes(codes []string) (statusCodes, error) {
+	result := make(statusCodes, 0, len(codes))
+	for _, code := range codes {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if len(code) != 3 || code[0] < '1' || code[0] > '5' {
+			return nil, fmt.Errorf("unknown HTTP status code %q", code)
+		}
+		if code[1:] != "xx" {
+			if _, err := strconv.Atoi(code); err != nil {
+				return nil, fmt.Errorf("unknown HTTP status code %q", code)
+			}
+		}
+		result = append(result, code)
+	}
+
+	return result, nil
+}
+
+func (c statusCodes) match(statusCode int) bool {
+	code := strconv.Itoa(statusCode)
+	for _, pattern := range c {
+		if pattern == code || (pattern[1:] == "xx" && pattern[0] == code[0]) {
+			return true
+		}
+	}
+
+	return false
+}
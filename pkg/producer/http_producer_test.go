@@ -0,0 +1,195 @@
+package producer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/stats-go"
+	"github.com/hellofresh/stats-go/bucket"
+	"github.com/hellofresh/stats-go/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+func newTestHTTPProducer(t *testing.T, httpConfig config.HTTPConfig) (*HTTPProducer, client.Client) {
+	statsClient, _ := stats.NewClient("memory://")
+
+	httpProducer, err := NewHTTPProducer(httpConfig, statsClient)
+	require.NoError(t, err)
+
+	return httpProducer.(*HTTPProducer), statsClient
+}
+
+func TestHTTPProducer_Publish(t *testing.T) {
+	var (
+		body    []byte
+		headers http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/hooks/orders", r.URL.Path)
+		body, _ = io.ReadAll(r.Body)
+		headers = r.Header
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	httpProducer, statsClient := newTestHTTPProducer(t, config.HTTPConfig{Timeout: time.Second})
+
+	msg := NewMessage([]byte(`{"id": 42}`), "")
+	msg.URL = server.URL + "/hooks/orders"
+	msg.Headers = map[string]string{HeaderContentType: "application/json", "x-tenant": "de"}
+
+	require.NoError(t, httpProducer.Publish(*msg))
+	assert.Equal(t, []byte(`{"id": 42}`), body)
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+	assert.Equal(t, "de", headers.Get("x-tenant"))
+	assert.Equal(t, msg.ID.String(), headers.Get(HeaderHTTPMessageID))
+
+	memoryStats, _ := statsClient.(*client.Memory)
+	host := bucket.SanitizeMetricName(server.Listener.Addr().String(), false)
+	assert.Equal(t, 1, memoryStats.CountMetrics[fmt.Sprintf("%s-ok.publish.%s.-", statsHTTPSection, host)])
+}
+
+func TestHTTPProducer_Publish_retry(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	httpProducer, _ := newTestHTTPProducer(t, config.HTTPConfig{
+		Timeout:       time.Second,
+		MaxRetry:      3,
+		RetryInterval: time.Millisecond,
+		RetryCodes:    []string{"5xx"},
+	})
+
+	msg := NewMessage([]byte("body"), "")
+	msg.URL = server.URL
+
+	require.NoError(t, httpProducer.Publish(*msg))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// retries are exhausted
+	atomic.StoreInt32(&requests, -10)
+	assert.Error(t, httpProducer.Publish(*msg))
+	assert.Equal(t, int32(-6), atomic.LoadInt32(&requests))
+}
+
+func TestHTTPProducer_Publish_noRetry(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	httpProducer, statsClient := newTestHTTPProducer(t, config.HTTPConfig{
+		Timeout:       time.Second,
+		MaxRetry:      3,
+		RetryInterval: time.Millisecond,
+		RetryCodes:    []string{"429", "5xx"},
+	})
+
+	msg := NewMessage([]byte("body"), "")
+	msg.URL = server.URL
+
+	assert.Error(t, httpProducer.Publish(*msg))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	memoryStats, _ := statsClient.(*client.Memory)
+	host := bucket.SanitizeMetricName(server.Listener.Addr().String(), false)
+	assert.Equal(t, 1, memoryStats.CountMetrics[fmt.Sprintf("%s-fail.publish.%s.-", statsHTTPSection, host)])
+}
+
+func TestHTTPProducer_Publish_timeout(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	httpProducer, _ := newTestHTTPProducer(t, config.HTTPConfig{
+		Timeout:       10 * time.Millisecond,
+		MaxRetry:      1,
+		RetryInterval: time.Millisecond,
+	})
+
+	msg := NewMessage([]byte("body"), "")
+	msg.URL = server.URL
+
+	// requests failed with network errors are always retried
+	assert.Error(t, httpProducer.Publish(*msg))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	msg.URL = ""
+	assert.Equal(t, errNoMessageURL, httpProducer.Publish(*msg))
+
+	assert.NoError(t, httpProducer.Close())
+}
+
+func TestNewHTTPProducer_errors(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+
+	_, err := NewHTTPProducer(config.HTTPConfig{SuccessCodes: []string{"ok"}}, statsClient)
+	assert.Error(t, err)
+
+	_, err = NewHTTPProducer(config.HTTPConfig{RetryCodes: []string{"6xx"}}, statsClient)
+	assert.Error(t, err)
+}
+
+func TestStatusCodes_match(t *testing.T) {
+	codes, err := newStatusCodes([]string{"2xx", "404", " 5XX "})
+	require.NoError(t, err)
+
+	for _, code := range []int{200, 202, 299, 404, 500, 503} {
+		assert.True(t, codes.match(code), code)
+	}
+	for _, code := range []int{301, 400, 403, 429} {
+		assert.False(t, codes.match(code), code)
+	}
+
+	for _, code := range []string{"", "20", "2000", "0xx", "2x0", "abc"} {
+		_, err := newStatusCodes([]string{code})
+		assert.Error(t, err, code)
+	}
+}
+
+func TestHTTPProducer_PublishBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	httpProducer, _ := newTestHTTPProducer(t, config.HTTPConfig{Timeout: time.Second})
+
+	messages := []Message{*NewMessage([]byte("first"), ""), *NewMessage([]byte("second"), ""), *NewMessage([]byte("third"), "")}
+	for i := range messages {
+		messages[i].URL = server.URL + "/hooks"
+	}
+	require.NoError(t, httpProducer.PublishBatch(messages))
+
+	messages[1].URL = server.URL + "/broken"
+	err := httpProducer.PublishBatch(messages)
+	assert.Error(t, err)
+	assert.NoError(t, MessageError(err, 0))
+	assert.Error(t, MessageError(err, 1))
+	assert.NoError(t, MessageError(err, 2))
+}
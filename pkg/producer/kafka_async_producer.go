@@ -0,0 +1,192 @@
+package producer
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/hellofresh/stats-go/client"
+)
+
+// AsyncKafkaProducer is a Producer implementation for publishing messages to Kafka without waiting
+// for every message to be acknowledged, number of messages waiting for acknowledgement is limited
+type AsyncKafkaProducer struct {
+	kafkaClient sarama.AsyncProducer
+	statsClient client.Client
+
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+
+	// mu guards sending to Kafka client input, that is closed by Kafka client on close
+	mu        sync.RWMutex
+	closed    bool
+	closing   chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	// closeErrs are errors of the messages failed while producer is closing, they are collected by results goroutine
+	closeErrs sarama.ProducerErrors
+}
+
+var errProducerClosed = errors.New("kafka producer is closed")
+
+// pendingMessage is attached to Kafka message to find its publishing callback
+type pendingMessage struct {
+	msg  Message
+	done func(err error)
+}
+
+func newAsyncKafkaProducer(kafkaClient sarama.AsyncProducer, maxInFlight int, statsClient client.Client) *AsyncKafkaProducer {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+
+	p := &AsyncKafkaProducer{
+		kafkaClient: kafkaClient,
+		statsClient: statsClient,
+		inFlight:    make(chan struct{}, maxInFlight),
+		closing:     make(chan struct{}),
+	}
+
+	// results are handled in a single goroutine, so callbacks are never called concurrently
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		successes, errs := kafkaClient.Successes(), kafkaClient.Errors()
+		for successes != nil || errs != nil {
+			select {
+			case producerMsg, ok := <-successes:
+				if !ok {
+					successes = nil
+					continue
+				}
+				p.complete(producerMsg, nil)
+			case producerErr, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				p.collectCloseError(producerErr)
+				p.complete(producerErr.Msg, producerErr.Err)
+			}
+		}
+	}()
+
+	return p
+}
+
+// Close flushes messages waiting to be published and closes Kafka connection, errors of the messages
+// failed to be flushed are returned. Messages published after close fail right away.
+func (p *AsyncKafkaProducer) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.closing)
+
+		// waits for the messages being sent to Kafka client input, so input is not used after it is closed
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+
+		p.kafkaClient.AsyncClose()
+		p.wg.Wait()
+
+		if len(p.closeErrs) > 0 {
+			p.closeErr = p.closeErrs
+		}
+	})
+
+	return p.closeErr
+}
+
+// collectCloseError keeps error of the message failed while producer is closing, so it is returned by Close
+func (p *AsyncKafkaProducer) collectCloseError(producerErr *sarama.ProducerError) {
+	select {
+	case <-p.closing:
+		p.closeErrs = append(p.closeErrs, producerErr)
+	default:
+	}
+}
+
+// Publish publishes message to Kafka and waits for it to be acknowledged
+func (p *AsyncKafkaProducer) Publish(msg Message) error {
+	result := make(chan error, 1)
+	p.PublishAsync(msg, func(err error) {
+		result <- err
+	})
+
+	return <-result
+}
+
+// PublishBatch publishes messages to Kafka and waits for all of them to be acknowledged
+func (p *AsyncKafkaProducer) PublishBatch(messages []Message) error {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	batchErr := &BatchError{Errors: make(map[int]error)}
+
+	wg.Add(len(messages))
+	for i, msg := range messages {
+		i := i
+		p.PublishAsync(msg, func(err error) {
+			defer wg.Done()
+			if err != nil {
+				mu.Lock()
+				batchErr.Errors[i] = err
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(batchErr.Errors) == 0 {
+		return nil
+	}
+	return batchErr
+}
+
+// PublishAsync sends message to Kafka, done is called from the producer goroutine once message
+// is acknowledged or failed to be published. Message published after producer is closed fails right away.
+func (p *AsyncKafkaProducer) PublishAsync(msg Message, done func(err error)) {
+	select {
+	case p.inFlight <- struct{}{}:
+	case <-p.closing:
+		p.fail(msg, done)
+		return
+	}
+
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		<-p.inFlight
+		p.fail(msg, done)
+		return
+	}
+
+	producerMsg := producerMessage(msg)
+	producerMsg.Metadata = &pendingMessage{msg: msg, done: done}
+	p.kafkaClient.Input() <- producerMsg
+	p.mu.RUnlock()
+}
+
+func (p *AsyncKafkaProducer) fail(msg Message, done func(err error)) {
+	trackPublish(p.statsClient, msg, errProducerClosed)
+	if done != nil {
+		done(errProducerClosed)
+	}
+}
+
+func (p *AsyncKafkaProducer) complete(producerMsg *sarama.ProducerMessage, err error) {
+	if producerMsg == nil {
+		return
+	}
+	pending, ok := producerMsg.Metadata.(*pendingMessage)
+	if !ok {
+		return
+	}
+	<-p.inFlight
+
+	trackPublish(p.statsClient, pending.msg, err)
+	if pending.done != nil {
+		pending.done(err)
+	}
+}
@@ -0,0 +1,195 @@
+package producer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/hellofresh/stats-go"
+	"github.com/hellofresh/stats-go/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+// manualAsyncProducer acknowledges messages only when test sends them to successes channel
+type manualAsyncProducer struct {
+	sarama.AsyncProducer
+
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+	// flushed, if set, keeps results open on close until test is done with flushing messages
+	flushed chan struct{}
+}
+
+func newManualAsyncProducer() *manualAsyncProducer {
+	return &manualAsyncProducer{
+		input:     make(chan *sarama.ProducerMessage, 10),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+	}
+}
+
+func (p *manualAsyncProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func (p *manualAsyncProducer) Successes() <-chan *sarama.ProducerMessage {
+	return p.successes
+}
+
+func (p *manualAsyncProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+func (p *manualAsyncProducer) AsyncClose() {
+	if p.flushed != nil {
+		<-p.flushed
+	}
+	close(p.successes)
+	close(p.errors)
+}
+
+func newMockAsyncProducer(t *testing.T) *mocks.AsyncProducer {
+	cnf := sarama.NewConfig()
+	cnf.Producer.Return.Successes = true
+
+	return mocks.NewAsyncProducer(t, cnf)
+}
+
+func TestAsyncKafkaProducer_Publish(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	kafkaClient := newMockAsyncProducer(t)
+	kafkaClient.ExpectInputAndSucceed()
+	kafkaClient.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+
+	p := newAsyncKafkaProducer(kafkaClient, 10, statsClient)
+
+	assert.NoError(t, p.Publish(Message{Topic: "orders", Body: []byte("created")}))
+	assert.Equal(t, sarama.ErrNotLeaderForPartition, p.Publish(Message{Topic: "orders", Body: []byte("updated")}))
+	require.NoError(t, p.Close())
+
+	memoryStats, _ := statsClient.(*client.Memory)
+	assert.Equal(t, 1, memoryStats.CountMetrics["kafka-ok.publish.orders.-"])
+	assert.Equal(t, 1, memoryStats.CountMetrics["kafka-fail.publish.orders.-"])
+}
+
+func TestAsyncKafkaProducer_PublishBatch(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	kafkaClient := newMockAsyncProducer(t)
+	kafkaClient.ExpectInputAndSucceed()
+	kafkaClient.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+	kafkaClient.ExpectInputAndSucceed()
+
+	p := newAsyncKafkaProducer(kafkaClient, 10, statsClient)
+
+	err := p.PublishBatch([]Message{{Topic: "orders"}, {Topic: "orders"}, {Topic: "orders"}})
+	require.NoError(t, p.Close())
+
+	var batchErr *BatchError
+	require.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, map[int]error{1: sarama.ErrNotLeaderForPartition}, batchErr.Errors)
+}
+
+func TestAsyncKafkaProducer_PublishAsync_maxInFlight(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	kafkaClient := newManualAsyncProducer()
+
+	p := newAsyncKafkaProducer(kafkaClient, 2, statsClient)
+
+	results := make(chan error, 3)
+	done := func(err error) {
+		results <- err
+	}
+
+	p.PublishAsync(Message{Topic: "orders"}, done)
+	p.PublishAsync(Message{Topic: "orders"}, done)
+
+	published := make(chan struct{})
+	go func() {
+		p.PublishAsync(Message{Topic: "orders"}, done)
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("message is published while max in-flight messages are not acknowledged")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	kafkaClient.successes <- <-kafkaClient.input
+	assert.NoError(t, <-results)
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("message is not published after in-flight message is acknowledged")
+	}
+
+	kafkaClient.errors <- &sarama.ProducerError{Msg: <-kafkaClient.input, Err: sarama.ErrRequestTimedOut}
+	assert.Equal(t, sarama.ErrRequestTimedOut, <-results)
+
+	require.NoError(t, p.Close())
+}
+
+func TestNewKafkaProducer_unknownMode(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+
+	_, err := NewKafkaProducer(config.KafkaConfig{ProducerMode: "batch"}, statsClient)
+	assert.Error(t, err)
+}
+
+func TestAsyncKafkaProducer_Close(t *testing.T) {
+	statsClient, _ := stats.NewClient("noop://")
+	kafkaClient := newManualAsyncProducer()
+	kafkaClient.flushed = make(chan struct{})
+
+	p := newAsyncKafkaProducer(kafkaClient, 1, statsClient)
+
+	results := make(chan error, 2)
+	done := func(err error) {
+		results <- err
+	}
+
+	p.PublishAsync(Message{Topic: "orders"}, done)
+
+	// message waiting for in-flight slot fails once producer is closing instead of being sent to closed input
+	blocked := make(chan struct{})
+	go func() {
+		p.PublishAsync(Message{Topic: "orders"}, done)
+		close(blocked)
+	}()
+
+	closed := make(chan error)
+	go func() {
+		closed <- p.Close()
+	}()
+
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatal("message waiting for in-flight slot is not failed on close")
+	}
+	assert.Equal(t, errProducerClosed, <-results)
+
+	// message flushed on close fails, its error is returned by close
+	kafkaClient.errors <- &sarama.ProducerError{Msg: <-kafkaClient.input, Err: sarama.ErrRequestTimedOut}
+	assert.Equal(t, sarama.ErrRequestTimedOut, <-results)
+	close(kafkaClient.flushed)
+
+	err := <-closed
+	var producerErrs sarama.ProducerErrors
+	require.True(t, errors.As(err, &producerErrs))
+	require.Len(t, producerErrs, 1)
+	assert.Equal(t, sarama.ErrRequestTimedOut, producerErrs[0].Err)
+
+	// closed producer does not send messages to Kafka client and can be closed again
+	p.PublishAsync(Message{Topic: "orders"}, done)
+	assert.Equal(t, errProducerClosed, <-results)
+	assert.Empty(t, kafkaClient.input)
+	assert.Equal(t, err, p.Close())
+}
@@ -1,12 +1,17 @@
 package producer
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+
 	"github.com/Shopify/sarama"
 	"github.com/hellofresh/stats-go/bucket"
 	"github.com/hellofresh/stats-go/client"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/kafka"
 )
 
 const (
@@ -19,20 +24,52 @@ type KafkaProducer struct {
 	statsClient client.Client
 }
 
-// NewKafkaProducer instantiates and establishes new Kafka connection
+// NewKafkaProducer instantiates and establishes new Kafka connection, producer type depends on producer mode
 func NewKafkaProducer(kafkaConfig config.KafkaConfig, statsClient client.Client) (Producer, error) {
-	cnf := sarama.NewConfig()
+	if kafkaConfig.ProducerMode != "" && kafkaConfig.ProducerMode != config.ProducerModeSync && kafkaConfig.ProducerMode != config.ProducerModeAsync {
+		return nil, fmt.Errorf("unknown Kafka producer mode %q", kafkaConfig.ProducerMode)
+	}
+
+	cnf, err := newSaramaConfig(kafkaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if kafkaConfig.ProducerMode == config.ProducerModeAsync {
+		kafkaClient, err := sarama.NewAsyncProducer(kafkaConfig.Brokers, cnf)
+		if err != nil {
+			return nil, err
+		}
+
+		return newAsyncKafkaProducer(kafkaClient, kafkaConfig.MaxInFlight, statsClient), nil
+	}
+
+	kafkaClient, err := sarama.NewSyncProducer(kafkaConfig.Brokers, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaProducer{kafkaClient: kafkaClient, statsClient: statsClient}, nil
+}
+
+func newSaramaConfig(kafkaConfig config.KafkaConfig) (*sarama.Config, error) {
+	cnf, err := kafka.NewClientConfig(kafkaConfig)
+	if err != nil {
+		return nil, err
+	}
 	cnf.Producer.RequiredAcks = sarama.WaitForAll
 	cnf.Producer.Retry.Max = kafkaConfig.MaxRetry
-	// Producer.Return.Successes must be true to be used in a SyncProducer
+	// Producer.Return.Successes must be true to be used in a SyncProducer,
+	// AsyncProducer needs it to acknowledge published messages
 	cnf.Producer.Return.Successes = true
 
-	kafkaClient, err := sarama.NewSyncProducer(kafkaConfig.Brokers, cnf)
+	partitioner, err := newPartitioner(kafkaConfig.Partitioner)
 	if err != nil {
 		return nil, err
 	}
+	cnf.Producer.Partitioner = partitioner
 
-	return &KafkaProducer{kafkaClient: kafkaClient, statsClient: statsClient}, nil
+	return cnf, nil
 }
 
 // Close closes Kafka connection
@@ -42,18 +79,84 @@ func (p *KafkaProducer) Close() error {
 
 // Publish publishes message to Kafka
 func (p *KafkaProducer) Publish(msg Message) error {
-	_, _, err := p.kafkaClient.SendMessage(&sarama.ProducerMessage{
-		Topic: msg.Topic,
-		Value: sarama.ByteEncoder(msg.Body),
-	})
+	_, _, err := p.kafkaClient.SendMessage(producerMessage(msg))
+	trackPublish(p.statsClient, msg, err)
 
+	return err
+}
+
+// PublishBatch publishes messages to Kafka in a single round trip
+func (p *KafkaProducer) PublishBatch(messages []Message) error {
+	producerMessages := make([]*sarama.ProducerMessage, len(messages))
+	indexes := make(map[*sarama.ProducerMessage]int, len(messages))
+	for i, msg := range messages {
+		producerMessages[i] = producerMessage(msg)
+		indexes[producerMessages[i]] = i
+	}
+
+	err := p.kafkaClient.SendMessages(producerMessages)
+
+	var producerErrors sarama.ProducerErrors
+	if errors.As(err, &producerErrors) {
+		batchErr := &BatchError{Errors: make(map[int]error, len(producerErrors))}
+		for _, producerErr := range producerErrors {
+			if i, ok := indexes[producerErr.Msg]; ok {
+				batchErr.Errors[i] = producerErr.Err
+			}
+		}
+		// if failed messages can not be matched, the whole batch is considered failed
+		if len(batchErr.Errors) > 0 {
+			err = batchErr
+		}
+	}
+
+	for i, msg := range messages {
+		trackPublish(p.statsClient, msg, MessageError(err, i))
+	}
+
+	return err
+}
+
+func trackPublish(statsClient client.Client, msg Message, err error) {
 	if err == nil {
 		log.WithField("msg", msg.String()).Debug("Successfully sent message to kafka")
 	} else {
 		log.WithError(err).WithField("msg", msg.String()).Error("Failed to publish message to kafka")
 	}
 	operation := bucket.NewMetricOperation("publish", msg.Topic)
-	p.statsClient.TrackOperation(statsKafkaSection, operation, nil, err == nil)
+	statsClient.TrackOperation(statsKafkaSection, operation, nil, err == nil)
+}
 
-	return err
+func producerMessage(msg Message) *sarama.ProducerMessage {
+	producerMessage := &sarama.ProducerMessage{
+		Topic:     msg.Topic,
+		Value:     sarama.ByteEncoder(msg.Body),
+		Headers:   recordHeaders(msg.Headers),
+		Partition: msg.Partition,
+	}
+	if msg.Key != nil {
+		producerMessage.Key = sarama.ByteEncoder(msg.Key)
+	}
+
+	return producerMessage
+}
+
+func recordHeaders(headers map[string]string) []sarama.RecordHeader {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	// sort header names to make records headers order predictable
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]sarama.RecordHeader, len(names))
+	for i, name := range names {
+		result[i] = sarama.RecordHeader{Key: []byte(name), Value: []byte(headers[name])}
+	}
+
+	return result
 }
@@ -4,12 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/hellofresh/stats-go"
 	"github.com/hellofresh/stats-go/bucket"
 	"github.com/hellofresh/stats-go/client"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/config"
 )
 
 type sendMessageResult struct {
@@ -21,6 +25,7 @@ type sendMessageResult struct {
 type mockSyncProducer struct {
 	sendMessageResult  sendMessageResult
 	sendMessagesResult error
+	sendMessagesFailed []int
 	closeResult        error
 
 	lastSendMessageParams  *sarama.ProducerMessage
@@ -34,9 +39,35 @@ func (p *mockSyncProducer) SendMessage(msg *sarama.ProducerMessage) (partition i
 
 func (p *mockSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
 	p.lastSendMessagesParams = msgs
+	if len(p.sendMessagesFailed) > 0 {
+		var producerErrors sarama.ProducerErrors
+		for _, i := range p.sendMessagesFailed {
+			producerErrors = append(producerErrors, &sarama.ProducerError{Msg: msgs[i], Err: sarama.ErrNotLeaderForPartition})
+		}
+		return producerErrors
+	}
 	return p.sendMessagesResult
 }
 
+// latencySyncProducer simulates network round trip of every SendMessage and SendMessages call
+type latencySyncProducer struct {
+	roundTrip time.Duration
+}
+
+func (p *latencySyncProducer) SendMessage(*sarama.ProducerMessage) (int32, int64, error) {
+	time.Sleep(p.roundTrip)
+	return 0, 0, nil
+}
+
+func (p *latencySyncProducer) SendMessages([]*sarama.ProducerMessage) error {
+	time.Sleep(p.roundTrip)
+	return nil
+}
+
+func (p *latencySyncProducer) Close() error {
+	return nil
+}
+
 func (p *mockSyncProducer) Close() error {
 	return p.closeResult
 }
@@ -76,6 +107,49 @@ func TestKafkaProducer_Publish(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, body, string(messageValue))
 	assert.Equal(t, topic, mockProducer.lastSendMessageParams.Topic)
+	assert.Nil(t, mockProducer.lastSendMessageParams.Key)
+}
+
+func TestKafkaProducer_Publish_key(t *testing.T) {
+	mockProducer := &mockSyncProducer{}
+	statsClient, _ := stats.NewClient("memory://")
+
+	msg := NewMessage([]byte("hello message body!"), "some topic")
+	msg.Key = []byte("customer-id")
+	msg.Partition = 3
+
+	kafkaProducer := &KafkaProducer{mockProducer, statsClient}
+
+	err := kafkaProducer.Publish(*msg)
+	assert.NoError(t, err)
+
+	messageKey, err := mockProducer.lastSendMessageParams.Key.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, "customer-id", string(messageKey))
+	assert.Equal(t, int32(3), mockProducer.lastSendMessageParams.Partition)
+}
+
+func TestKafkaProducer_Publish_headers(t *testing.T) {
+	mockProducer := &mockSyncProducer{}
+	statsClient, _ := stats.NewClient("memory://")
+
+	msg := NewMessage([]byte("hello message body!"), "some topic")
+	msg.Headers = map[string]string{
+		HeaderRoutingKey:    "order.created",
+		HeaderCorrelationID: "correlation-id",
+		"x-tenant":          "de",
+	}
+
+	kafkaProducer := &KafkaProducer{mockProducer, statsClient}
+
+	err := kafkaProducer.Publish(*msg)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []sarama.RecordHeader{
+		{Key: []byte(HeaderCorrelationID), Value: []byte("correlation-id")},
+		{Key: []byte(HeaderRoutingKey), Value: []byte("order.created")},
+		{Key: []byte("x-tenant"), Value: []byte("de")},
+	}, mockProducer.lastSendMessageParams.Headers)
 }
 
 func TestKafkaProducer_Publish_error(t *testing.T) {
@@ -100,3 +174,122 @@ func TestKafkaProducer_Publish_error(t *testing.T) {
 	assert.Equal(t, 0, memoryStats.CountMetrics[fmt.Sprintf("%s-ok.publish.%s.-", statsKafkaSection, bucket.SanitizeMetricName(topic, false))])
 	assert.Equal(t, 1, memoryStats.CountMetrics[fmt.Sprintf("%s-fail.publish.%s.-", statsKafkaSection, bucket.SanitizeMetricName(topic, false))])
 }
+
+func TestKafkaProducer_PublishBatch(t *testing.T) {
+	mockProducer := &mockSyncProducer{}
+	statsClient, _ := stats.NewClient("memory://")
+	kafkaProducer := &KafkaProducer{mockProducer, statsClient}
+
+	messages := []Message{*NewMessage([]byte("first"), "orders"), *NewMessage([]byte("second"), "orders")}
+	messages[1].Key = []byte("customer-id")
+
+	require.NoError(t, kafkaProducer.PublishBatch(messages))
+	require.Len(t, mockProducer.lastSendMessagesParams, 2)
+	assert.Equal(t, sarama.ByteEncoder("first"), mockProducer.lastSendMessagesParams[0].Value)
+	assert.Equal(t, sarama.ByteEncoder("customer-id"), mockProducer.lastSendMessagesParams[1].Key)
+
+	memoryStats, _ := statsClient.(*client.Memory)
+	assert.Equal(t, 2, memoryStats.CountMetrics[fmt.Sprintf("%s-ok.publish.orders.-", statsKafkaSection)])
+}
+
+func TestKafkaProducer_PublishBatch_partialFailure(t *testing.T) {
+	mockProducer := &mockSyncProducer{sendMessagesFailed: []int{1, 2}}
+	statsClient, _ := stats.NewClient("memory://")
+	kafkaProducer := &KafkaProducer{mockProducer, statsClient}
+
+	messages := []Message{*NewMessage([]byte("first"), "orders"), *NewMessage([]byte("second"), "orders"), *NewMessage([]byte("third"), "orders")}
+
+	err := kafkaProducer.PublishBatch(messages)
+	require.Error(t, err)
+
+	var batchErr *BatchError
+	require.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, map[int]error{1: sarama.ErrNotLeaderForPartition, 2: sarama.ErrNotLeaderForPartition}, batchErr.Errors)
+	assert.NoError(t, MessageError(err, 0))
+	assert.Equal(t, sarama.ErrNotLeaderForPartition, MessageError(err, 1))
+
+	memoryStats, _ := statsClient.(*client.Memory)
+	assert.Equal(t, 1, memoryStats.CountMetrics[fmt.Sprintf("%s-ok.publish.orders.-", statsKafkaSection)])
+	assert.Equal(t, 2, memoryStats.CountMetrics[fmt.Sprintf("%s-fail.publish.orders.-", statsKafkaSection)])
+}
+
+func TestKafkaProducer_PublishBatch_error(t *testing.T) {
+	sendMessagesError := errors.New("send messages error")
+	mockProducer := &mockSyncProducer{sendMessagesResult: sendMessagesError}
+	statsClient, _ := stats.NewClient("memory://")
+	kafkaProducer := &KafkaProducer{mockProducer, statsClient}
+
+	messages := []Message{*NewMessage([]byte("first"), "orders"), *NewMessage([]byte("second"), "orders")}
+
+	err := kafkaProducer.PublishBatch(messages)
+	assert.Equal(t, sendMessagesError, err)
+	assert.Equal(t, sendMessagesError, MessageError(err, 0))
+	assert.Equal(t, sendMessagesError, MessageError(err, 1))
+
+	// errors of unknown messages can not be matched, so the whole batch fails
+	mockProducer.sendMessagesResult = sarama.ProducerErrors{{Msg: &sarama.ProducerMessage{}, Err: sarama.ErrNotLeaderForPartition}}
+	err = kafkaProducer.PublishBatch(messages)
+	assert.Error(t, MessageError(err, 0))
+	assert.Error(t, MessageError(err, 1))
+
+	memoryStats, _ := statsClient.(*client.Memory)
+	assert.Equal(t, 4, memoryStats.CountMetrics[fmt.Sprintf("%s-fail.publish.orders.-", statsKafkaSection)])
+}
+
+func benchmarkMessages(count int) []Message {
+	messages := make([]Message, count)
+	for i := range messages {
+		messages[i] = *NewMessage([]byte(`{"order": {"customer_id": 42}}`), "orders")
+	}
+
+	return messages
+}
+
+// BenchmarkKafkaProducer_Publish publishes messages one by one, paying network round trip per message
+func BenchmarkKafkaProducer_Publish(b *testing.B) {
+	statsClient, _ := stats.NewClient("noop://")
+	kafkaProducer := &KafkaProducer{&latencySyncProducer{roundTrip: 100 * time.Microsecond}, statsClient}
+	messages := benchmarkMessages(100)
+
+	start := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, msg := range messages {
+			if err := kafkaProducer.Publish(msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(b.N*len(messages))/time.Since(start).Seconds(), "msgs/s")
+}
+
+// BenchmarkKafkaProducer_PublishBatch publishes messages in a batch, paying network round trip per batch
+func BenchmarkKafkaProducer_PublishBatch(b *testing.B) {
+	statsClient, _ := stats.NewClient("noop://")
+	kafkaProducer := &KafkaProducer{&latencySyncProducer{roundTrip: 100 * time.Microsecond}, statsClient}
+	messages := benchmarkMessages(100)
+
+	start := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := kafkaProducer.PublishBatch(messages); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N*len(messages))/time.Since(start).Seconds(), "msgs/s")
+}
+
+func TestNewSaramaConfig(t *testing.T) {
+	cnf, err := newSaramaConfig(config.KafkaConfig{MaxRetry: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 3, cnf.Producer.Retry.Max)
+	assert.True(t, cnf.Producer.Return.Successes)
+	assert.False(t, cnf.Net.TLS.Enable)
+
+	cnf, err = newSaramaConfig(config.KafkaConfig{TLS: config.KafkaTLSConfig{Enabled: true, ServerName: "kafka.local"}})
+	require.NoError(t, err)
+	assert.True(t, cnf.Net.TLS.Enable)
+
+	_, err = newSaramaConfig(config.KafkaConfig{SASL: config.KafkaSASLConfig{Enabled: true, Mechanism: "GSSAPI"}})
+	assert.Error(t, err)
+}
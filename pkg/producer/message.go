@@ -6,19 +6,71 @@ import (
 	"github.com/gofrs/uuid"
 )
 
-// Message struct contains data for message read from RabbitMQ and ready for sending to Kafka
+// Names of the headers that hold AMQP message properties
+const (
+	HeaderExchange      = "amqp-exchange"
+	HeaderRoutingKey    = "amqp-routing-key"
+	HeaderContentType   = "amqp-content-type"
+	HeaderCorrelationID = "amqp-correlation-id"
+	HeaderMessageID     = "amqp-message-id"
+	HeaderTimestamp     = "amqp-timestamp"
+)
+
+// Acknowledger is an interface for confirming message handling to the message source
+type Acknowledger interface {
+	// Ack confirms that message is handled and can be removed from the source
+	Ack() error
+	// Nack rejects message, if requeue is true source should deliver it again
+	Nack(requeue bool) error
+}
+
+// Message struct contains data for message read from RabbitMQ and ready for sending to Kafka or HTTP destination
 type Message struct {
-	ID    uuid.UUID `json:"id"`
-	Body  []byte    `json:"body"`
-	Topic string    `json:"topic"`
+	ID        uuid.UUID         `json:"id"`
+	Body      []byte            `json:"body"`
+	Topic     string            `json:"topic"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Key       []byte            `json:"key,omitempty"`
+	Partition int32             `json:"partition,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	// Replayed is true for the message read from persistent storage, it is not stored itself
+	Replayed bool `json:"-"`
+
+	acknowledger Acknowledger
 }
 
 // NewMessage initializes and instantiates new Message
 func NewMessage(body []byte, topic string) *Message {
-	return &Message{uuid.Must(uuid.NewV4()), body, topic}
+	return &Message{ID: uuid.Must(uuid.NewV4()), Body: body, Topic: topic}
 }
 
 // String represents message as simple string value
 func (m Message) String() string {
 	return fmt.Sprintf("{id: %s, topic: %s}", m.ID.String(), m.Topic)
 }
+
+// SetAcknowledger sets acknowledger that is notified when message is durably handled
+func (m *Message) SetAcknowledger(acknowledger Acknowledger) {
+	m.acknowledger = acknowledger
+}
+
+// HasAcknowledger returns true if message source waits for message handling confirmation
+func (m Message) HasAcknowledger() bool {
+	return m.acknowledger != nil
+}
+
+// Ack confirms message handling to the message source, if there is one waiting for it
+func (m Message) Ack() error {
+	if m.acknowledger == nil {
+		return nil
+	}
+	return m.acknowledger.Ack()
+}
+
+// Nack rejects message to the message source, if there is one waiting for confirmation
+func (m Message) Nack(requeue bool) error {
+	if m.acknowledger == nil {
+		return nil
+	}
+	return m.acknowledger.Nack(requeue)
+}
@@ -31,3 +31,36 @@ func TestMessage_String(t *testing.T) {
 	assert.True(t, strings.Contains(msgString, "id"))
 	assert.True(t, strings.Contains(msgString, "topic"))
 }
+
+type mockAcknowledger struct {
+	acked   bool
+	requeue bool
+}
+
+func (a *mockAcknowledger) Ack() error {
+	a.acked = true
+	return nil
+}
+
+func (a *mockAcknowledger) Nack(requeue bool) error {
+	a.requeue = requeue
+	return nil
+}
+
+func TestMessage_Ack(t *testing.T) {
+	msg := NewMessage([]byte("message body"), "message topic")
+	assert.False(t, msg.HasAcknowledger())
+	assert.NoError(t, msg.Ack())
+	assert.NoError(t, msg.Nack(true))
+
+	acknowledger := &mockAcknowledger{}
+	msg.SetAcknowledger(acknowledger)
+	assert.True(t, msg.HasAcknowledger())
+
+	assert.NoError(t, msg.Nack(true))
+	assert.True(t, acknowledger.requeue)
+	assert.False(t, acknowledger.acked)
+
+	assert.NoError(t, msg.Ack())
+	assert.True(t, acknowledger.acked)
+}
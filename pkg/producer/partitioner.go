@@ -0,0 +1,96 @@
+package producer
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+// newPartitioner returns Kafka partitioner constructor by its name
+func newPartitioner(name string) (sarama.PartitionerConstructor, error) {
+	switch name {
+	case "", config.PartitionerHash:
+		return sarama.NewHashPartitioner, nil
+	case config.PartitionerMurmur2:
+		return NewMurmur2Partitioner, nil
+	case config.PartitionerRoundRobin:
+		return sarama.NewRoundRobinPartitioner, nil
+	case config.PartitionerRandom:
+		return sarama.NewRandomPartitioner, nil
+	case config.PartitionerManual:
+		return sarama.NewManualPartitioner, nil
+	}
+
+	return nil, fmt.Errorf("unknown kafka partitioner %q", name)
+}
+
+type murmur2Partitioner struct {
+	random sarama.Partitioner
+}
+
+// NewMurmur2Partitioner returns Partitioner that is compatible with Java client default partitioner,
+// it uses murmur2 hash of message key to choose partition, random partition is chosen for messages without key
+func NewMurmur2Partitioner(topic string) sarama.Partitioner {
+	return &murmur2Partitioner{random: sarama.NewRandomPartitioner(topic)}
+}
+
+// Partition takes a message and partition count and chooses a partition
+func (p *murmur2Partitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Key == nil {
+		return p.random.Partition(message, numPartitions)
+	}
+
+	key, err := message.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+
+	return int32(murmur2(key)&0x7fffffff) % numPartitions, nil
+}
+
+// RequiresConsistency indicates that the same key always goes to the same partition
+func (p *murmur2Partitioner) RequiresConsistency() bool {
+	return true
+}
+
+// murmur2 is a port of the hash function used by Java Kafka client
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return h
+}
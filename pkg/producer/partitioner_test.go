@@ -0,0 +1,50 @@
+package producer
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMurmur2(t *testing.T) {
+	// values are taken from Java client tests to make sure implementations are compatible
+	cases := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+
+	for data, expected := range cases {
+		assert.Equal(t, expected, int32(murmur2([]byte(data))), data)
+	}
+}
+
+func TestMurmur2Partitioner(t *testing.T) {
+	partitioner := NewMurmur2Partitioner("topic")
+	assert.True(t, partitioner.RequiresConsistency())
+
+	partition, err := partitioner.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("foobar")}, 10)
+	require.NoError(t, err)
+	// (-790332482 & 0x7fffffff) % 10
+	assert.Equal(t, int32(6), partition)
+
+	partition, err = partitioner.Partition(&sarama.ProducerMessage{}, 10)
+	require.NoError(t, err)
+	assert.True(t, partition >= 0 && partition < 10)
+}
+
+func TestNewPartitioner(t *testing.T) {
+	for _, name := range []string{"", "hash", "murmur2", "round-robin", "random", "manual"} {
+		constructor, err := newPartitioner(name)
+		assert.NoError(t, err, name)
+		assert.NotNil(t, constructor, name)
+	}
+
+	_, err := newPartitioner("unknown")
+	assert.Error(t, err)
+}
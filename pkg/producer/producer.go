@@ -1,7 +1,62 @@
 package producer
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // Producer is an interface for publishing messages service
 type Producer interface {
 	Publish(msg Message) error
+	// PublishBatch publishes several messages at once, *BatchError is returned if only some of them failed,
+	// any other error means that none of the messages is published
+	PublishBatch(messages []Message) error
 	Close() error
 }
+
+// AsyncProducer is a Producer that can publish messages without waiting for their results
+type AsyncProducer interface {
+	Producer
+	// PublishAsync publishes message and calls done with publishing result once it is known,
+	// it blocks while max number of messages are waiting for their results
+	PublishAsync(msg Message, done func(err error))
+}
+
+// BatchError is returned when only some of the batch messages failed to be published
+type BatchError struct {
+	// Errors holds publishing errors by message index in the batch
+	Errors map[int]error
+}
+
+// Error returns errors of all the failed messages
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	messages := make([]string, len(indexes))
+	for i, index := range indexes {
+		messages[i] = fmt.Sprintf("message %d: %s", index, e.Errors[index])
+	}
+
+	return fmt.Sprintf("failed to publish %d messages of the batch: %s", len(indexes), strings.Join(messages, "; "))
+}
+
+// MessageError returns publishing error of the message by its index in the batch,
+// batchErr is PublishBatch result
+func MessageError(batchErr error, index int) error {
+	if batchErr == nil {
+		return nil
+	}
+
+	var e *BatchError
+	if errors.As(batchErr, &e) {
+		return e.Errors[index]
+	}
+
+	return batchErr
+}
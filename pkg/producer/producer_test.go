@@ -0,0 +1,26 @@
+package producer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchError_Error(t *testing.T) {
+	err := &BatchError{Errors: map[int]error{3: errors.New("timeout"), 1: errors.New("not leader")}}
+	assert.Equal(t, "failed to publish 2 messages of the batch: message 1: not leader; message 3: timeout", err.Error())
+}
+
+func TestMessageError(t *testing.T) {
+	assert.NoError(t, MessageError(nil, 0))
+
+	publishErr := errors.New("kafka is not available")
+	assert.Equal(t, publishErr, MessageError(publishErr, 0))
+	assert.Equal(t, publishErr, MessageError(publishErr, 1))
+
+	batchErr := fmt.Errorf("wrapped: %w", &BatchError{Errors: map[int]error{1: publishErr}})
+	assert.NoError(t, MessageError(batchErr, 0))
+	assert.Equal(t, publishErr, MessageError(batchErr, 1))
+}
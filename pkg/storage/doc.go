@@ -1,4 +1,5 @@
 /*
-Package storage holds interface and Redis implementation for messages storage in case producer is not currently available.
+Package storage holds interface and Redis and local file implementations for messages storage in case producer
+is not currently available.
 */
 package storage
@@ -0,0 +1,550 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// FileSyncAlways flushes every write and read offset change to disk
+	FileSyncAlways = "always"
+	// FileSyncNever leaves flushing to disk up to operating system
+	FileSyncNever = "never"
+
+	fileSegmentExt   = ".log"
+	fileOffsetName   = "offset"
+	fileRecordHeader = 8
+	fileOffsetSize   = 16
+
+	defaultFileSync        = FileSyncAlways
+	defaultFileSegmentSize = 64 << 20
+)
+
+var (
+	// ErrFileStorageCorrupted is an error raised when file storage record is corrupted,
+	// the rest of the corrupted segment is skipped
+	ErrFileStorageCorrupted = errors.New("File storage segment is corrupted, skipping the rest of the segment")
+	// ErrFileSyncInvalid is an error raised when 'fsync' parameter has invalid value for file storage type
+	ErrFileSyncInvalid = errors.New("File storage 'fsync' parameter must be 'always', 'never' or a valid duration")
+	// ErrFileDirMissed is an error raised when directory path is missing for file storage type
+	ErrFileDirMissed = errors.New("File storage requires directory path, e.g. 'file:///var/lib/kandalf'")
+	// ErrFileSegmentSizeInvalid is an error raised when 'segmentSize' parameter is not a positive integer for file storage type
+	ErrFileSegmentSizeInvalid = errors.New("File storage 'segmentSize' parameter must be a positive number of bytes")
+)
+
+// FileStorage is a PersistentStorage interface implementation that keeps messages in append-only log on local disk.
+// Log is split into segments, every record is prefixed with data length and checksum.
+// Read position is persisted in a separate file, so storage survives process restarts,
+// and completely read segments are removed from disk.
+type FileStorage struct {
+	sync.Mutex
+
+	dir          string
+	segmentSize  int64
+	syncAlways   bool
+	syncInterval time.Duration
+	stopSync     chan struct{}
+	closeOnce    sync.Once
+	closeErr     error
+
+	writer    *os.File
+	writeID   uint64
+	writeSize int64
+
+	reader  *os.File
+	readEnd int64
+	readID  uint64
+	readPos int64
+
+	// records is a number of records that are not read yet
+	records    int
+	offsetFile *os.File
+}
+
+// NewFileStorage instantiates file storage in the given directory, restoring its state if directory already has data.
+// fsync is either "always", "never" or flush interval duration string.
+func NewFileStorage(dir string, fsync string, segmentSize int64) (*FileStorage, error) {
+	s := &FileStorage{dir: dir, segmentSize: segmentSize}
+
+	switch fsync {
+	case FileSyncAlways:
+		s.syncAlways = true
+	case FileSyncNever:
+	default:
+		interval, err := time.ParseDuration(fsync)
+		if err != nil || interval <= 0 {
+			return nil, ErrFileSyncInvalid
+		}
+		s.syncInterval = interval
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+
+	if s.syncInterval > 0 {
+		s.stopSync = make(chan struct{})
+		go s.syncPeriodically()
+	}
+
+	return s, nil
+}
+
+func (s *FileStorage) open() error {
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		segments = []uint64{1}
+	}
+
+	if s.offsetFile, err = os.OpenFile(filepath.Join(s.dir, fileOffsetName), os.O_RDWR|os.O_CREATE, 0644); err != nil {
+		return err
+	}
+	if err = s.readOffset(); err != nil {
+		return err
+	}
+
+	// read position points to a segment that was already removed or was never created
+	if s.readID < segments[0] || s.readID > segments[len(segments)-1] {
+		s.readID, s.readPos = segments[0], 0
+	}
+
+	// segments before the read one are already consumed, but were not removed, e.g. because of crash
+	for _, id := range segments {
+		if id < s.readID {
+			if err = os.Remove(s.segmentPath(id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.writeID = segments[len(segments)-1]
+	if s.writer, err = os.OpenFile(s.segmentPath(s.writeID), os.O_RDWR|os.O_CREATE, 0644); err != nil {
+		return err
+	}
+	if err = s.recoverWriter(); err != nil {
+		return err
+	}
+
+	// incomplete records the read position pointed after were truncated
+	if s.readID == s.writeID && s.readPos > s.writeSize {
+		s.readPos = s.writeSize
+	}
+
+	return s.countRecords()
+}
+
+// recoverWriter truncates incomplete or corrupted records at the end of the last segment,
+// that could be left there by process crash in the middle of the write
+func (s *FileStorage) recoverWriter() error {
+	info, err := s.writer.Stat()
+	if err != nil {
+		return err
+	}
+
+	var pos int64
+	for {
+		data, err := readRecord(s.writer, pos, info.Size())
+		if err != nil {
+			break
+		}
+		pos += int64(fileRecordHeader + len(data))
+	}
+
+	if info.Size() != pos {
+		log.WithFields(log.Fields{"segment": s.writer.Name(), "size": info.Size(), "valid_size": pos}).
+			Warn("Truncating incomplete records in file storage segment")
+		if err = s.writer.Truncate(pos); err != nil {
+			return err
+		}
+	}
+
+	s.writeSize = pos
+	return nil
+}
+
+// countRecords counts records after the read position by their headers, it is called on open
+// and after corrupted records are skipped, otherwise the number is updated on every write and read
+func (s *FileStorage) countRecords() error {
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	s.records = 0
+	for _, id := range segments {
+		if id < s.readID {
+			continue
+		}
+
+		file, end := s.writer, s.writeSize
+		if id != s.writeID {
+			if file, err = os.Open(s.segmentPath(id)); err != nil {
+				return err
+			}
+			info, err := file.Stat()
+			if err != nil {
+				file.Close()
+				return err
+			}
+			end = info.Size()
+		}
+
+		var pos int64
+		if id == s.readID {
+			pos = s.readPos
+		}
+
+		var header [fileRecordHeader]byte
+		for pos+fileRecordHeader <= end {
+			if _, err = file.ReadAt(header[:], pos); err != nil {
+				break
+			}
+			pos += fileRecordHeader + int64(binary.BigEndian.Uint32(header[:4]))
+			if pos > end {
+				break
+			}
+			s.records++
+		}
+
+		if file != s.writer {
+			file.Close()
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStorage) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, fileSegmentExt) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, fileSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, id)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+
+	return segments, nil
+}
+
+func (s *FileStorage) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, fileSegmentExt))
+}
+
+func (s *FileStorage) readOffset() error {
+	var buf [fileOffsetSize]byte
+	n, err := s.offsetFile.ReadAt(buf[:], 0)
+	if err == io.EOF && n < fileOffsetSize {
+		// offset was never written
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.readID = binary.BigEndian.Uint64(buf[:8])
+	s.readPos = int64(binary.BigEndian.Uint64(buf[8:]))
+	return nil
+}
+
+func (s *FileStorage) writeOffset() error {
+	var buf [fileOffsetSize]byte
+	binary.BigEndian.PutUint64(buf[:8], s.readID)
+	binary.BigEndian.PutUint64(buf[8:], uint64(s.readPos))
+
+	if _, err := s.offsetFile.WriteAt(buf[:], 0); err != nil {
+		return err
+	}
+	if s.syncAlways {
+		return s.offsetFile.Sync()
+	}
+	return nil
+}
+
+// Put appends data to the log
+func (s *FileStorage) Put(data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	recordSize := int64(fileRecordHeader + len(data))
+	if s.writeSize > 0 && s.writeSize+recordSize > s.segmentSize {
+		if err := s.rollWriter(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[fileRecordHeader:], data)
+
+	if _, err := s.writer.WriteAt(record, s.writeSize); err != nil {
+		return err
+	}
+	s.writeSize += recordSize
+	s.records++
+
+	if s.syncAlways {
+		return s.writer.Sync()
+	}
+	return nil
+}
+
+// Ping checks that storage directory and the segment that is being written are available
+func (s *FileStorage) Ping() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, err := os.Stat(s.dir); err != nil {
+		return err
+	}
+
+	_, err := s.writer.Stat()
+	return err
+}
+
+// Len returns number of records that are not read yet
+func (s *FileStorage) Len() (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.records, nil
+}
+
+// rollWriter starts new log segment
+func (s *FileStorage) rollWriter() error {
+	if err := s.writer.Sync(); err != nil {
+		return err
+	}
+	if err := s.writer.Close(); err != nil {
+		return err
+	}
+
+	writer, err := os.OpenFile(s.segmentPath(s.writeID+1), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	s.writer, s.writeID, s.writeSize = writer, s.writeID+1, 0
+	return nil
+}
+
+// Get reads data from the log, if no more data in the storage "ErrStorageIsEmpty" is returned
+func (s *FileStorage) Get() ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for {
+		if s.readID == s.writeID && s.readPos >= s.writeSize {
+			return nil, ErrStorageIsEmpty
+		}
+
+		reader, end, err := s.getReader()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := readRecord(reader, s.readPos, end)
+		if err == io.EOF {
+			if err = s.nextSegment(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, s.skipCorrupted(err)
+		}
+
+		s.readPos += int64(fileRecordHeader + len(data))
+		s.records--
+		if err = s.writeOffset(); err != nil {
+			return nil, err
+		}
+
+		return data, nil
+	}
+}
+
+// getReader returns file of the segment that is being read and its size
+func (s *FileStorage) getReader() (*os.File, int64, error) {
+	if s.readID == s.writeID {
+		return s.writer, s.writeSize, nil
+	}
+	if s.reader != nil {
+		return s.reader, s.readEnd, nil
+	}
+
+	reader, err := os.Open(s.segmentPath(s.readID))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := reader.Stat()
+	if err != nil {
+		reader.Close()
+		return nil, 0, err
+	}
+
+	s.reader, s.readEnd = reader, info.Size()
+	return s.reader, s.readEnd, nil
+}
+
+// nextSegment moves read position to the next segment and removes completely read one
+func (s *FileStorage) nextSegment() error {
+	if s.reader != nil {
+		if err := s.reader.Close(); err != nil {
+			return err
+		}
+		s.reader = nil
+	}
+
+	consumedID := s.readID
+	s.readID, s.readPos = s.readID+1, 0
+	if err := s.writeOffset(); err != nil {
+		return err
+	}
+
+	return os.Remove(s.segmentPath(consumedID))
+}
+
+// skipCorrupted skips the rest of the segment that is being read
+func (s *FileStorage) skipCorrupted(err error) error {
+	log.WithError(err).WithFields(log.Fields{"segment": s.readID, "position": s.readPos}).
+		Error("Failed to read record from file storage")
+
+	if s.readID == s.writeID {
+		// new records can not be appended after corrupted one
+		if err = s.rollWriter(); err != nil {
+			return err
+		}
+	}
+	if err = s.nextSegment(); err != nil {
+		return err
+	}
+	if err = s.countRecords(); err != nil {
+		return err
+	}
+
+	return ErrFileStorageCorrupted
+}
+
+// readRecord reads record data at given position of the segment of given size,
+// io.EOF is returned if there are no more records in the segment
+func readRecord(file *os.File, pos, end int64) ([]byte, error) {
+	if pos >= end {
+		return nil, io.EOF
+	}
+	if pos+fileRecordHeader > end {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var header [fileRecordHeader]byte
+	if _, err := file.ReadAt(header[:], pos); err != nil {
+		return nil, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	if pos+fileRecordHeader+size > end {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, size)
+	if _, err := file.ReadAt(data, pos+fileRecordHeader); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(header[4:]) != crc32.ChecksumIEEE(data) {
+		return nil, fmt.Errorf("record checksum mismatch at position %d", pos)
+	}
+
+	return data, nil
+}
+
+func (s *FileStorage) syncPeriodically() {
+	ticker := time.NewTicker(s.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopSync:
+			return
+		case <-ticker.C:
+			if err := s.sync(); err != nil {
+				log.WithError(err).Error("Failed to flush file storage to disk")
+			}
+		}
+	}
+}
+
+func (s *FileStorage) sync() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.writer.Sync(); err != nil {
+		return err
+	}
+	return s.offsetFile.Sync()
+}
+
+// Close flushes all the data to disk and closes storage files, closing storage again returns the same result
+func (s *FileStorage) Close() error {
+	s.closeOnce.Do(func() {
+		if s.stopSync != nil {
+			close(s.stopSync)
+		}
+
+		err := s.sync()
+
+		s.Lock()
+		defer s.Unlock()
+		if closeErr := s.closeFiles(); err == nil {
+			err = closeErr
+		}
+
+		s.closeErr = err
+	})
+
+	return s.closeErr
+}
+
+func (s *FileStorage) closeFiles() error {
+	var err error
+	for _, file := range []*os.File{s.writer, s.reader, s.offsetFile} {
+		if file == nil {
+			continue
+		}
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func putMessages(t *testing.T, s PersistentStorage, messages ...string) {
+	for _, msg := range messages {
+		require.NoError(t, s.Put([]byte(msg)))
+	}
+}
+
+func getMessages(t *testing.T, s PersistentStorage) []string {
+	var result []string
+	for {
+		data, err := s.Get()
+		if err == ErrStorageIsEmpty {
+			return result
+		}
+		require.NoError(t, err)
+		result = append(result, string(data))
+	}
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+fileSegmentExt))
+	require.NoError(t, err)
+	return files
+}
+
+func TestFileStorage_PutGet(t *testing.T) {
+	fileStorage, err := NewFileStorage(t.TempDir(), FileSyncAlways, defaultFileSegmentSize)
+	require.NoError(t, err)
+	defer fileStorage.Close()
+
+	_, err = fileStorage.Get()
+	assert.Equal(t, ErrStorageIsEmpty, err)
+
+	putMessages(t, fileStorage, "msg-1", "msg-2", "msg-3")
+
+	data, err := fileStorage.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "msg-1", string(data))
+
+	putMessages(t, fileStorage, "msg-4")
+	assert.Equal(t, []string{"msg-2", "msg-3", "msg-4"}, getMessages(t, fileStorage))
+
+	_, err = fileStorage.Get()
+	assert.Equal(t, ErrStorageIsEmpty, err)
+}
+
+func TestFileStorage_restart(t *testing.T) {
+	dir := t.TempDir()
+
+	fileStorage, err := NewFileStorage(dir, FileSyncNever, defaultFileSegmentSize)
+	require.NoError(t, err)
+
+	putMessages(t, fileStorage, "msg-1", "msg-2", "msg-3")
+	data, err := fileStorage.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "msg-1", string(data))
+	require.NoError(t, fileStorage.Close())
+
+	fileStorage, err = NewFileStorage(dir, FileSyncNever, defaultFileSegmentSize)
+	require.NoError(t, err)
+	defer fileStorage.Close()
+
+	// already read message is not returned again after restart
+	putMessages(t, fileStorage, "msg-4")
+	assert.Equal(t, []string{"msg-2", "msg-3", "msg-4"}, getMessages(t, fileStorage))
+}
+
+func TestFileStorage_Close(t *testing.T) {
+	fileStorage, err := NewFileStorage(t.TempDir(), "100ms", defaultFileSegmentSize)
+	require.NoError(t, err)
+
+	putMessages(t, fileStorage, "msg-1")
+	require.NoError(t, fileStorage.Close())
+	assert.NoError(t, fileStorage.Close())
+}
+
+func TestFileStorage_segments(t *testing.T) {
+	dir := t.TempDir()
+
+	// every segment fits only two records
+	recordSize := int64(fileRecordHeader + len("msg-1"))
+	fileStorage, err := NewFileStorage(dir, FileSyncAlways, recordSize*2)
+	require.NoError(t, err)
+
+	putMessages(t, fileStorage, "msg-1", "msg-2", "msg-3", "msg-4", "msg-5")
+	assert.Len(t, segmentFiles(t, dir), 3)
+
+	for i := 1; i <= 3; i++ {
+		data, err := fileStorage.Get()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("msg-%d", i), string(data))
+	}
+	require.NoError(t, fileStorage.Close())
+
+	fileStorage, err = NewFileStorage(dir, FileSyncAlways, recordSize*2)
+	require.NoError(t, err)
+	defer fileStorage.Close()
+
+	assert.Equal(t, []string{"msg-4", "msg-5"}, getMessages(t, fileStorage))
+
+	// consumed segments are compacted, only the one that is written to is left
+	assert.Equal(t, []string{filepath.Join(dir, fmt.Sprintf("%020d%s", 3, fileSegmentExt))}, segmentFiles(t, dir))
+}
+
+func TestFileStorage_incompleteWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	fileStorage, err := NewFileStorage(dir, FileSyncAlways, defaultFileSegmentSize)
+	require.NoError(t, err)
+	putMessages(t, fileStorage, "msg-1", "msg-2")
+	require.NoError(t, fileStorage.Close())
+
+	// emulate crash in the middle of the write
+	segment, err := os.OpenFile(fileStorage.segmentPath(1), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = segment.Write([]byte{0, 0, 0, 10, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, segment.Close())
+
+	fileStorage, err = NewFileStorage(dir, FileSyncAlways, defaultFileSegmentSize)
+	require.NoError(t, err)
+	defer fileStorage.Close()
+
+	putMessages(t, fileStorage, "msg-3")
+	assert.Equal(t, []string{"msg-1", "msg-2", "msg-3"}, getMessages(t, fileStorage))
+}
+
+func TestFileStorage_corrupted(t *testing.T) {
+	dir := t.TempDir()
+
+	recordSize := int64(fileRecordHeader + len("msg-1"))
+	fileStorage, err := NewFileStorage(dir, FileSyncAlways, recordSize*2)
+	require.NoError(t, err)
+	defer fileStorage.Close()
+
+	putMessages(t, fileStorage, "msg-1", "msg-2", "msg-3")
+
+	// damage data of the first record
+	segment, err := os.OpenFile(fileStorage.segmentPath(1), os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = segment.WriteAt([]byte("X"), fileRecordHeader)
+	require.NoError(t, err)
+	require.NoError(t, segment.Close())
+
+	_, err = fileStorage.Get()
+	assert.Equal(t, ErrFileStorageCorrupted, err)
+
+	// the rest of the corrupted segment is skipped
+	assert.Equal(t, []string{"msg-3"}, getMessages(t, fileStorage))
+}
+
+func TestFileStorage_invalidSync(t *testing.T) {
+	_, err := NewFileStorage(t.TempDir(), "sometimes", defaultFileSegmentSize)
+	assert.Equal(t, ErrFileSyncInvalid, err)
+}
+
+func TestFileStorage_Len(t *testing.T) {
+	dir := t.TempDir()
+
+	recordSize := int64(fileRecordHeader + len("msg-1"))
+	fileStorage, err := NewFileStorage(dir, FileSyncAlways, recordSize*2)
+	require.NoError(t, err)
+	assert.NoError(t, fileStorage.Ping())
+
+	putMessages(t, fileStorage, "msg-1", "msg-2", "msg-3", "msg-4", "msg-5")
+	_, err = fileStorage.Get()
+	require.NoError(t, err)
+
+	n, err := fileStorage.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	require.NoError(t, fileStorage.Close())
+	assert.Error(t, fileStorage.Ping())
+
+	// records left in all the segments are counted after restart
+	fileStorage, err = NewFileStorage(dir, FileSyncAlways, recordSize*2)
+	require.NoError(t, err)
+	defer fileStorage.Close()
+
+	n, err = fileStorage.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	getMessages(t, fileStorage)
+	n, err = fileStorage.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestFileStorage_Len_corrupted(t *testing.T) {
+	dir := t.TempDir()
+
+	recordSize := int64(fileRecordHeader + len("msg-1"))
+	fileStorage, err := NewFileStorage(dir, FileSyncAlways, recordSize*2)
+	require.NoError(t, err)
+	defer fileStorage.Close()
+
+	putMessages(t, fileStorage, "msg-1", "msg-2", "msg-3")
+
+	segment, err := os.OpenFile(fileStorage.segmentPath(1), os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = segment.WriteAt([]byte("X"), fileRecordHeader)
+	require.NoError(t, err)
+	require.NoError(t, segment.Close())
+
+	// skipped records are not counted anymore
+	_, err = fileStorage.Get()
+	assert.Equal(t, ErrFileStorageCorrupted, err)
+	n, err := fileStorage.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
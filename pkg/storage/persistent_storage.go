@@ -3,6 +3,10 @@ package storage
 import (
 	"errors"
 	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -14,6 +18,17 @@ var (
 	ErrUnknownStorage = errors.New("Unknown storage type")
 	// ErrRedisKeyMissed is an error raised when 'key' parameter is missing for redis storage type
 	ErrRedisKeyMissed = errors.New("Redis storage requires 'key' parameter")
+	// ErrRedisUnknownOrder is an error raised when 'order' parameter has unknown value for redis storage type
+	ErrRedisUnknownOrder = errors.New("Redis storage 'order' parameter must be either 'lifo' or 'fifo'")
+	// ErrStorageNotAvailable is an error raised when storage does not respond to ping as expected
+	ErrStorageNotAvailable = errors.New("Storage is not available")
+	// ErrRedisClaimIdleInvalid is an error raised when 'claimIdle' parameter is not a valid duration for redis stream storage type
+	ErrRedisClaimIdleInvalid = errors.New("Redis stream storage 'claimIdle' parameter must be a valid duration")
+)
+
+const (
+	defaultRedisStreamGroup     = "kandalf"
+	defaultRedisStreamClaimIdle = 5 * time.Minute
 )
 
 // PersistentStorage is an interface for persistent storage
@@ -26,6 +41,39 @@ type PersistentStorage interface {
 	Close() error
 }
 
+// Acknowledger is an interface for confirming that data read from persistent storage is handled
+type Acknowledger interface {
+	// Ack confirms that data is handled and can be removed from storage
+	Ack() error
+	// Nack rejects data, if requeue is true data stays in storage and will be read again
+	Nack(requeue bool) error
+}
+
+// AcknowledgingStorage is an interface for persistent storage that keeps read data until it is acknowledged
+type AcknowledgingStorage interface {
+	PersistentStorage
+	// Reserve reads data from persistent storage, data is removed from storage only after it is acknowledged,
+	// if no more data in the storage "ErrStorageIsEmpty" is returned
+	Reserve() ([]byte, Acknowledger, error)
+}
+
+// RequeueingStorage is an interface for persistent storage that can put data it returned back to the read end,
+// so data that failed to be handled after it was read is read again before data stored after it
+type RequeueingStorage interface {
+	PersistentStorage
+	// Requeue writes data read from persistent storage back, so it is read next
+	Requeue(data []byte) error
+}
+
+// MonitoredStorage is an interface for persistent storage that can report its state
+type MonitoredStorage interface {
+	PersistentStorage
+	// Ping checks that storage is available
+	Ping() error
+	// Len returns number of messages in storage
+	Len() (int, error)
+}
+
 // NewPersistentStorage instantiates and establishes connection to persistent storage of given type
 func NewPersistentStorage(dsn *url.URL) (PersistentStorage, error) {
 	log.WithField("dsn", dsn.String()).Debug("Trying to instantiate new persistent storage instance")
@@ -36,7 +84,88 @@ func NewPersistentStorage(dsn *url.URL) (PersistentStorage, error) {
 		if len(dsn.Query().Get("key")) < 1 {
 			return nil, ErrRedisKeyMissed
 		}
-		return NewRedisStorage(dsn, dsn.Query().Get("key"))
+
+		order := dsn.Query().Get("order")
+		switch order {
+		case "":
+			order = RedisOrderLIFO
+		case RedisOrderLIFO, RedisOrderFIFO:
+		default:
+			return nil, ErrRedisUnknownOrder
+		}
+		return NewRedisStorage(dsn, dsn.Query().Get("key"), order)
+	case "redis+stream":
+		if len(dsn.Query().Get("key")) < 1 {
+			return nil, ErrRedisKeyMissed
+		}
+
+		group := dsn.Query().Get("group")
+		if group == "" {
+			group = defaultRedisStreamGroup
+		}
+
+		consumer := dsn.Query().Get("consumer")
+		if consumer == "" {
+			host, err := os.Hostname()
+			if err != nil {
+				return nil, err
+			}
+			consumer = host
+		}
+
+		claimIdle := defaultRedisStreamClaimIdle
+		if value := dsn.Query().Get("claimIdle"); value != "" {
+			var err error
+			if claimIdle, err = time.ParseDuration(value); err != nil {
+				return nil, ErrRedisClaimIdleInvalid
+			}
+		}
+		return NewRedisStreamStorage(dsn, dsn.Query().Get("key"), group, consumer, claimIdle)
+	case "file":
+		dir := fileDir(dsn)
+		if dir == "" {
+			return nil, ErrFileDirMissed
+		}
+
+		fsync := dsn.Query().Get("fsync")
+		if fsync == "" {
+			fsync = defaultFileSync
+		}
+
+		segmentSize := int64(defaultFileSegmentSize)
+		if value := dsn.Query().Get("segmentSize"); value != "" {
+			var err error
+			if segmentSize, err = strconv.ParseInt(value, 10, 64); err != nil || segmentSize <= 0 {
+				return nil, ErrFileSegmentSizeInvalid
+			}
+		}
+		return NewFileStorage(dir, fsync, segmentSize)
 	}
 	return nil, ErrUnknownStorage
 }
+
+// NamespacedDSN returns persistent storage DSN for given namespace, so several workers sharing the same
+// storage configuration do not read each other data: namespace is appended to the key of redis storages
+// and to the directory of file storage
+func NamespacedDSN(dsn *url.URL, namespace string) *url.URL {
+	namespaced := *dsn
+
+	switch dsn.Scheme {
+	case "redis", "redis+stream":
+		query := dsn.Query()
+		query.Set("key", query.Get("key")+":"+namespace)
+		namespaced.RawQuery = query.Encode()
+	case "file":
+		// path of the DSN with host is relative to the host, e.g. "file://data" is "data" directory
+		if fileDir(dsn) != "" {
+			namespaced.Path = path.Join("/", dsn.Path, namespace)
+		}
+	}
+
+	return &namespaced
+}
+
+// fileDir returns directory of file storage DSN, both "file:///var/lib/kandalf" and "file://data" forms are supported
+func fileDir(dsn *url.URL) string {
+	return dsn.Host + dsn.Path
+}
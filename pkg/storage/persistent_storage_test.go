@@ -2,9 +2,12 @@ package storage
 
 import (
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewPersistentStorage_ErrUnknownStorage(t *testing.T) {
@@ -22,3 +25,80 @@ func TestNewPersistentStorage_ErrRedisKeyMissed(t *testing.T) {
 	assert.NotEmpty(t, err)
 	assert.Equal(t, ErrRedisKeyMissed, err)
 }
+
+func TestNewPersistentStorage_ErrRedisUnknownOrder(t *testing.T) {
+	dsn, _ := url.Parse("redis://localhost/?key=kandalf&order=random")
+	storage, err := NewPersistentStorage(dsn)
+	assert.Nil(t, storage)
+	assert.NotEmpty(t, err)
+	assert.Equal(t, ErrRedisUnknownOrder, err)
+}
+
+func TestNewPersistentStorage_ErrRedisClaimIdleInvalid(t *testing.T) {
+	dsn, _ := url.Parse("redis+stream://localhost/?key=kandalf&claimIdle=forever")
+	storage, err := NewPersistentStorage(dsn)
+	assert.Nil(t, storage)
+	assert.NotEmpty(t, err)
+	assert.Equal(t, ErrRedisClaimIdleInvalid, err)
+}
+
+func TestNewPersistentStorage_file(t *testing.T) {
+	dsn, _ := url.Parse("file://" + t.TempDir() + "?fsync=1s&segmentSize=1024")
+	storage, err := NewPersistentStorage(dsn)
+	assert.NoError(t, err)
+	assert.IsType(t, &FileStorage{}, storage)
+	assert.NoError(t, storage.Close())
+
+	dsn, _ = url.Parse("file://" + t.TempDir() + "?segmentSize=-1")
+	storage, err = NewPersistentStorage(dsn)
+	assert.Nil(t, storage)
+	assert.Equal(t, ErrFileSegmentSizeInvalid, err)
+
+	dsn, _ = url.Parse("file://")
+	storage, err = NewPersistentStorage(dsn)
+	assert.Nil(t, storage)
+	assert.Equal(t, ErrFileDirMissed, err)
+}
+
+func TestNamespacedDSN(t *testing.T) {
+	for dsn, expected := range map[string]string{
+		"redis://localhost:6379/?key=kandalf&order=fifo": "redis://localhost:6379/?key=kandalf%3Aanalytics&order=fifo",
+		"redis+stream://localhost:6379/?key=kandalf":     "redis+stream://localhost:6379/?key=kandalf%3Aanalytics",
+		"file:///var/lib/kandalf?fsync=never":            "file:///var/lib/kandalf/analytics?fsync=never",
+		"file://data":                                    "file://data/analytics",
+		"unknown://localhost":                            "unknown://localhost",
+	} {
+		parsed, err := url.Parse(dsn)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, NamespacedDSN(parsed, "analytics").String(), dsn)
+		assert.Equal(t, dsn, parsed.String(), "original DSN is not changed")
+	}
+
+	// file DSN without directory stays invalid
+	parsed, _ := url.Parse("file://")
+	assert.Empty(t, fileDir(NamespacedDSN(parsed, "analytics")))
+}
+
+func TestNamespacedDSN_fileDir(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	for dsn, expected := range map[string]string{
+		"file://" + filepath.Join(dir, "absolute"): filepath.Join(dir, "absolute", "analytics"),
+		"file://relative":                          filepath.Join(dir, "relative", "analytics"),
+	} {
+		parsed, err := url.Parse(dsn)
+		require.NoError(t, err)
+
+		storage, err := NewPersistentStorage(NamespacedDSN(parsed, "analytics"))
+		require.NoError(t, err, dsn)
+		require.NoError(t, storage.Close())
+
+		info, err := os.Stat(expected)
+		require.NoError(t, err, dsn)
+		assert.True(t, info.IsDir(), dsn)
+	}
+}
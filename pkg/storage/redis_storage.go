@@ -7,21 +7,31 @@ import (
 	"github.com/gomodule/redigo/redis"
 )
 
-// RedisStorage is a PersistentStorage interface implementation for Redis DB
+const (
+	// RedisOrderLIFO reads the most recently stored messages first
+	RedisOrderLIFO = "lifo"
+	// RedisOrderFIFO reads messages in the same order they were stored
+	RedisOrderFIFO = "fifo"
+)
+
+// RedisStorage is a PersistentStorage interface implementation for Redis DB.
+// Messages are always pushed to the head of the list, so stored data layout does not depend on reading order
+// and existing lists can be read in any order without migration.
 type RedisStorage struct {
-	pool *redis.Pool
-	key  string
+	pool  *redis.Pool
+	key   string
+	order string
 }
 
 // NewRedisStorage instantiates and establishes connection to Redis storage
-func NewRedisStorage(dsn *url.URL, key string) (*RedisStorage, error) {
+func NewRedisStorage(dsn *url.URL, key string, order string) (*RedisStorage, error) {
 	pool := &redis.Pool{
 		MaxIdle:     3,
 		IdleTimeout: 240 * time.Second,
 		Dial:        func() (redis.Conn, error) { return redis.DialURL(dsn.String()) },
 	}
 
-	redisStorage := &RedisStorage{pool, key}
+	redisStorage := &RedisStorage{pool, key, order}
 
 	conn := redisStorage.getConnection()
 	defer conn.Close()
@@ -45,6 +55,34 @@ func (s *RedisStorage) ping(conn redis.Conn) (bool, error) {
 	return data == "PONG", nil
 }
 
+// Ping checks that Redis is available
+func (s *RedisStorage) Ping() error {
+	conn := s.getConnection()
+	defer conn.Close()
+
+	ok, err := s.ping(conn)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrStorageNotAvailable
+	}
+
+	return nil
+}
+
+// Len returns number of messages in Redis list
+func (s *RedisStorage) Len() (int, error) {
+	conn := s.getConnection()
+	defer conn.Close()
+
+	return s.len(conn)
+}
+
+func (s *RedisStorage) len(conn redis.Conn) (int, error) {
+	return redis.Int(conn.Do("LLEN", s.key))
+}
+
 // Put writes data to Redis
 func (s *RedisStorage) Put(data []byte) error {
 	conn := s.getConnection()
@@ -58,6 +96,23 @@ func (s *RedisStorage) put(conn redis.Conn, data []byte) (int, error) {
 	return redis.Int(conn.Do("LPUSH", s.key, data))
 }
 
+// Requeue writes data read from Redis back to the end of the list it is read from, so in FIFO order
+// data that failed to be handled keeps its place before data stored after it
+func (s *RedisStorage) Requeue(data []byte) error {
+	conn := s.getConnection()
+	defer conn.Close()
+
+	_, err := s.requeue(conn, data)
+	return err
+}
+
+func (s *RedisStorage) requeue(conn redis.Conn, data []byte) (int, error) {
+	if s.order == RedisOrderFIFO {
+		return redis.Int(conn.Do("RPUSH", s.key, data))
+	}
+	return s.put(conn, data)
+}
+
 // Get reads data from redis, if no more data in the storage "ErrStorageIsEmpty" is returned
 func (s *RedisStorage) Get() ([]byte, error) {
 	conn := s.getConnection()
@@ -67,7 +122,7 @@ func (s *RedisStorage) Get() ([]byte, error) {
 }
 
 func (s *RedisStorage) get(conn redis.Conn) ([]byte, error) {
-	result, err := redis.Bytes(conn.Do("LPOP", s.key))
+	result, err := redis.Bytes(conn.Do(s.popCommand(), s.key))
 	if err == redis.ErrNil {
 		return nil, ErrStorageIsEmpty
 	}
@@ -75,6 +130,15 @@ func (s *RedisStorage) get(conn redis.Conn) ([]byte, error) {
 	return result, err
 }
 
+// popCommand returns command that reads messages from the head of the list for LIFO order,
+// or from the tail of the list for FIFO order
+func (s *RedisStorage) popCommand() string {
+	if s.order == RedisOrderFIFO {
+		return "RPOP"
+	}
+	return "LPOP"
+}
+
 // Close closes connection to redis
 func (s *RedisStorage) Close() error {
 	return s.pool.Close()
@@ -127,3 +127,109 @@ func TestRedisStorage_get_error(t *testing.T) {
 	assert.NotEmpty(t, err)
 	assert.Equal(t, redisErr, err)
 }
+
+func TestRedisStorage_get_fifo(t *testing.T) {
+	data := []byte("Some data")
+	key := uuid.Must(uuid.NewV4()).String()
+
+	conn := redigomock.NewConn()
+	cmd := conn.Command("RPOP", key).Expect(data)
+	defer conn.Clear()
+
+	redisStorage := &RedisStorage{key: key, order: RedisOrderFIFO}
+
+	result, err := redisStorage.get(conn)
+	assert.Equal(t, 1, conn.Stats(cmd))
+	assert.Nil(t, err)
+	assert.Equal(t, data, result)
+}
+
+// mockRedisList emulates redis list commands used by the storage
+func mockRedisList(conn *redigomock.Conn, key string) {
+	var list [][]byte
+
+	conn.Command("LPUSH", key, redigomock.NewAnyData()).Handle(func(args []interface{}) (interface{}, error) {
+		list = append([][]byte{args[1].([]byte)}, list...)
+		return int64(len(list)), nil
+	})
+	conn.Command("RPUSH", key, redigomock.NewAnyData()).Handle(func(args []interface{}) (interface{}, error) {
+		list = append(list, args[1].([]byte))
+		return int64(len(list)), nil
+	})
+	conn.Command("LPOP", key).Handle(func(args []interface{}) (interface{}, error) {
+		if len(list) == 0 {
+			return nil, nil
+		}
+		head := list[0]
+		list = list[1:]
+		return head, nil
+	})
+	conn.Command("RPOP", key).Handle(func(args []interface{}) (interface{}, error) {
+		if len(list) == 0 {
+			return nil, nil
+		}
+		tail := list[len(list)-1]
+		list = list[:len(list)-1]
+		return tail, nil
+	})
+}
+
+func assertOutageAndReplayOrder(t *testing.T, order string, expected []string) {
+	key := uuid.Must(uuid.NewV4()).String()
+
+	conn := redigomock.NewConn()
+	mockRedisList(conn, key)
+	defer conn.Clear()
+
+	redisStorage := &RedisStorage{key: key, order: order}
+
+	// Kafka is down, all messages go to the storage
+	for _, msg := range []string{"msg-1", "msg-2", "msg-3"} {
+		_, err := redisStorage.put(conn, []byte(msg))
+		assert.NoError(t, err)
+	}
+
+	// Kafka is back, but first replayed message fails to be published and is requeued
+	// while new message arrives before the next replay cycle
+	first, err := redisStorage.get(conn)
+	assert.NoError(t, err)
+	_, err = redisStorage.requeue(conn, first)
+	assert.NoError(t, err)
+	_, err = redisStorage.put(conn, []byte("msg-4"))
+	assert.NoError(t, err)
+
+	var replayed []string
+	for {
+		data, err := redisStorage.get(conn)
+		if err == ErrStorageIsEmpty {
+			break
+		}
+		assert.NoError(t, err)
+		replayed = append(replayed, string(data))
+	}
+
+	assert.Equal(t, expected, replayed)
+}
+
+func TestRedisStorage_order_fifo(t *testing.T) {
+	assertOutageAndReplayOrder(t, RedisOrderFIFO, []string{"msg-1", "msg-2", "msg-3", "msg-4"})
+}
+
+func TestRedisStorage_order_lifo(t *testing.T) {
+	assertOutageAndReplayOrder(t, RedisOrderLIFO, []string{"msg-4", "msg-3", "msg-2", "msg-1"})
+}
+
+func TestRedisStorage_len(t *testing.T) {
+	key := uuid.Must(uuid.NewV4()).String()
+
+	conn := redigomock.NewConn()
+	cmd := conn.Command("LLEN", key).Expect(int64(3))
+	defer conn.Clear()
+
+	redisStorage := &RedisStorage{key: key}
+
+	n, err := redisStorage.len(conn)
+	assert.Equal(t, 1, conn.Stats(cmd))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
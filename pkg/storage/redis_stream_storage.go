@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const redisStreamDataField = "data"
+
+// RedisStreamStorage is an AcknowledgingStorage interface implementation for Redis Streams.
+// Messages are read using consumer group, so read message stays pending until it is acknowledged.
+// Pending messages that were not acknowledged during "claimIdle" interval, e.g. because of consumer crash,
+// are claimed and read again by any consumer of the group. Requires Redis 6.2 or newer.
+type RedisStreamStorage struct {
+	pool      *redis.Pool
+	key       string
+	group     string
+	consumer  string
+	claimIdle time.Duration
+}
+
+// NewRedisStreamStorage instantiates and establishes connection to Redis Streams storage
+func NewRedisStreamStorage(dsn *url.URL, key, group, consumer string, claimIdle time.Duration) (*RedisStreamStorage, error) {
+	redisDSN := *dsn
+	redisDSN.Scheme = "redis"
+
+	pool := &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial:        func() (redis.Conn, error) { return redis.DialURL(redisDSN.String()) },
+	}
+
+	streamStorage := &RedisStreamStorage{pool, key, group, consumer, claimIdle}
+
+	conn := streamStorage.getConnection()
+	defer conn.Close()
+	if err := streamStorage.createGroup(conn); err != nil {
+		return nil, err
+	}
+
+	return streamStorage, nil
+}
+
+func (s *RedisStreamStorage) getConnection() redis.Conn {
+	return s.pool.Get()
+}
+
+// createGroup creates stream and consumer group if they do not exist yet,
+// group is created from the beginning of the stream to read messages that were stored before
+func (s *RedisStreamStorage) createGroup(conn redis.Conn) error {
+	_, err := conn.Do("XGROUP", "CREATE", s.key, s.group, "0", "MKSTREAM")
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+
+	return err
+}
+
+// Ping checks that Redis is available
+func (s *RedisStreamStorage) Ping() error {
+	conn := s.getConnection()
+	defer conn.Close()
+
+	pong, err := redis.String(conn.Do("PING"))
+	if err != nil {
+		return err
+	}
+	if pong != "PONG" {
+		return ErrStorageNotAvailable
+	}
+
+	return nil
+}
+
+// Len returns number of messages in Redis stream, including the reserved ones that are not acknowledged yet
+func (s *RedisStreamStorage) Len() (int, error) {
+	conn := s.getConnection()
+	defer conn.Close()
+
+	return s.len(conn)
+}
+
+func (s *RedisStreamStorage) len(conn redis.Conn) (int, error) {
+	return redis.Int(conn.Do("XLEN", s.key))
+}
+
+// Put writes data to Redis stream
+func (s *RedisStreamStorage) Put(data []byte) error {
+	conn := s.getConnection()
+	defer conn.Close()
+
+	_, err := s.put(conn, data)
+	return err
+}
+
+func (s *RedisStreamStorage) put(conn redis.Conn, data []byte) (string, error) {
+	return redis.String(conn.Do("XADD", s.key, "*", redisStreamDataField, data))
+}
+
+// Get reads data from Redis stream and removes it right away,
+// if no more data in the storage "ErrStorageIsEmpty" is returned
+func (s *RedisStreamStorage) Get() ([]byte, error) {
+	data, acknowledger, err := s.Reserve()
+	if err != nil {
+		return nil, err
+	}
+
+	return data, acknowledger.Ack()
+}
+
+// Reserve reads data from Redis stream, data is removed from the stream only after it is acknowledged,
+// if no more data in the storage "ErrStorageIsEmpty" is returned
+func (s *RedisStreamStorage) Reserve() ([]byte, Acknowledger, error) {
+	conn := s.getConnection()
+	defer conn.Close()
+
+	id, data, err := s.reserve(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, &redisStreamAcknowledger{s, id}, nil
+}
+
+// reserve claims stale pending entry of any group consumer first, reads new entry if there is nothing to claim
+func (s *RedisStreamStorage) reserve(conn redis.Conn) (string, []byte, error) {
+	id, data, err := s.claim(conn)
+	if err != nil || id != "" {
+		return id, data, err
+	}
+
+	id, data, err = s.read(conn)
+	if err != nil {
+		return "", nil, err
+	}
+	if id == "" {
+		return "", nil, ErrStorageIsEmpty
+	}
+
+	return id, data, nil
+}
+
+func (s *RedisStreamStorage) claim(conn redis.Conn) (string, []byte, error) {
+	for {
+		reply, err := redis.Values(conn.Do(
+			"XAUTOCLAIM", s.key, s.group, s.consumer, s.claimIdle.Milliseconds(), "0-0", "COUNT", 1,
+		))
+		if err != nil {
+			return "", nil, err
+		}
+		if len(reply) < 2 {
+			return "", nil, fmt.Errorf("unexpected XAUTOCLAIM reply length %d", len(reply))
+		}
+
+		entries, err := redis.Values(reply[1], nil)
+		if err != nil && err != redis.ErrNil {
+			return "", nil, err
+		}
+		if len(entries) == 0 {
+			return "", nil, nil
+		}
+
+		id, data, err := parseStreamEntry(entries[0])
+		if err != nil {
+			return "", nil, err
+		}
+		if data != nil {
+			return id, data, nil
+		}
+
+		// entry was deleted from the stream while it was pending, nothing to read here
+		if err := s.ack(conn, id); err != nil {
+			return "", nil, err
+		}
+	}
+}
+
+func (s *RedisStreamStorage) read(conn redis.Conn) (string, []byte, error) {
+	reply, err := redis.Values(conn.Do(
+		"XREADGROUP", "GROUP", s.group, s.consumer, "COUNT", 1, "STREAMS", s.key, ">",
+	))
+	if err == redis.ErrNil {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, stream := range reply {
+		streamReply, err := redis.Values(stream, nil)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(streamReply) < 2 {
+			return "", nil, fmt.Errorf("unexpected XREADGROUP stream reply length %d", len(streamReply))
+		}
+
+		entries, err := redis.Values(streamReply[1], nil)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(entries) > 0 {
+			return parseStreamEntry(entries[0])
+		}
+	}
+
+	return "", nil, nil
+}
+
+// parseStreamEntry parses stream entry reply, nil data is returned for deleted entries
+func parseStreamEntry(entry interface{}) (string, []byte, error) {
+	entryReply, err := redis.Values(entry, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(entryReply) < 2 {
+		return "", nil, fmt.Errorf("unexpected stream entry reply length %d", len(entryReply))
+	}
+
+	id, err := redis.String(entryReply[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if entryReply[1] == nil {
+		return id, nil, nil
+	}
+
+	fields, err := redis.ByteSlices(entryReply[1], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if string(fields[i]) == redisStreamDataField {
+			return id, fields[i+1], nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("stream entry %s has no %q field", id, redisStreamDataField)
+}
+
+func (s *RedisStreamStorage) ack(conn redis.Conn, id string) error {
+	if _, err := conn.Do("XACK", s.key, s.group, id); err != nil {
+		return err
+	}
+
+	_, err := conn.Do("XDEL", s.key, id)
+	return err
+}
+
+// Close closes connection to redis
+func (s *RedisStreamStorage) Close() error {
+	return s.pool.Close()
+}
+
+type redisStreamAcknowledger struct {
+	storage *RedisStreamStorage
+	id      string
+}
+
+// Ack removes entry from the stream
+func (a *redisStreamAcknowledger) Ack() error {
+	conn := a.storage.getConnection()
+	defer conn.Close()
+
+	return a.storage.ack(conn, a.id)
+}
+
+// Nack leaves entry pending to be claimed again after "claimIdle" interval if requeue is true,
+// otherwise entry is removed from the stream
+func (a *redisStreamAcknowledger) Nack(requeue bool) error {
+	if requeue {
+		return nil
+	}
+
+	return a.Ack()
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rafaeljusto/redigomock/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestStreamStorage() *RedisStreamStorage {
+	return &RedisStreamStorage{
+		key:       uuid.Must(uuid.NewV4()).String(),
+		group:     "kandalf",
+		consumer:  "kandalf-1",
+		claimIdle: time.Minute,
+	}
+}
+
+func expectClaim(conn *redigomock.Conn, s *RedisStreamStorage) *redigomock.Cmd {
+	return conn.Command("XAUTOCLAIM", s.key, s.group, s.consumer, int64(60000), "0-0", "COUNT", 1)
+}
+
+func expectRead(conn *redigomock.Conn, s *RedisStreamStorage) *redigomock.Cmd {
+	return conn.Command("XREADGROUP", "GROUP", s.group, s.consumer, "COUNT", 1, "STREAMS", s.key, ">")
+}
+
+func streamEntry(id string, data []byte) []interface{} {
+	return []interface{}{[]byte(id), []interface{}{[]byte(redisStreamDataField), data}}
+}
+
+func TestRedisStreamStorage_createGroup(t *testing.T) {
+	streamStorage := getTestStreamStorage()
+
+	conn := redigomock.NewConn()
+	cmd := conn.Command("XGROUP", "CREATE", streamStorage.key, streamStorage.group, "0", "MKSTREAM").Expect("OK")
+	defer conn.Clear()
+
+	assert.NoError(t, streamStorage.createGroup(conn))
+	assert.Equal(t, 1, conn.Stats(cmd))
+
+	conn.Clear()
+	cmd = conn.Command("XGROUP", "CREATE", streamStorage.key, streamStorage.group, "0", "MKSTREAM").
+		ExpectError(errors.New("BUSYGROUP Consumer Group name already exists"))
+
+	assert.NoError(t, streamStorage.createGroup(conn))
+	assert.Equal(t, 1, conn.Stats(cmd))
+}
+
+func TestRedisStreamStorage_put(t *testing.T) {
+	streamStorage := getTestStreamStorage()
+	data := []byte("Some data")
+
+	conn := redigomock.NewConn()
+	cmd := conn.Command("XADD", streamStorage.key, "*", redisStreamDataField, data).Expect([]byte("1-0"))
+	defer conn.Clear()
+
+	id, err := streamStorage.put(conn, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "1-0", id)
+	assert.Equal(t, 1, conn.Stats(cmd))
+}
+
+func TestRedisStreamStorage_reserve_read(t *testing.T) {
+	streamStorage := getTestStreamStorage()
+	data := []byte("Some data")
+
+	conn := redigomock.NewConn()
+	claimCmd := expectClaim(conn, streamStorage).Expect([]interface{}{[]byte("0-0"), []interface{}{}})
+	readCmd := expectRead(conn, streamStorage).Expect([]interface{}{
+		[]interface{}{[]byte(streamStorage.key), []interface{}{streamEntry("1-0", data)}},
+	})
+	defer conn.Clear()
+
+	id, result, err := streamStorage.reserve(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "1-0", id)
+	assert.Equal(t, data, result)
+	assert.Equal(t, 1, conn.Stats(claimCmd))
+	assert.Equal(t, 1, conn.Stats(readCmd))
+}
+
+func TestRedisStreamStorage_reserve_claim(t *testing.T) {
+	streamStorage := getTestStreamStorage()
+	data := []byte("Some data")
+
+	conn := redigomock.NewConn()
+	// stale entry of crashed replica is claimed before reading new entries
+	claimCmd := expectClaim(conn, streamStorage).Expect([]interface{}{
+		[]byte("0-0"), []interface{}{streamEntry("1-0", data)},
+	})
+	readCmd := expectRead(conn, streamStorage).Expect(nil)
+	defer conn.Clear()
+
+	id, result, err := streamStorage.reserve(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "1-0", id)
+	assert.Equal(t, data, result)
+	assert.Equal(t, 1, conn.Stats(claimCmd))
+	assert.Equal(t, 0, conn.Stats(readCmd))
+}
+
+func TestRedisStreamStorage_reserve_claimDeleted(t *testing.T) {
+	streamStorage := getTestStreamStorage()
+	data := []byte("Some data")
+
+	conn := redigomock.NewConn()
+	claimCmd := expectClaim(conn, streamStorage).
+		Expect([]interface{}{[]byte("0-0"), []interface{}{[]interface{}{[]byte("1-0"), nil}}}).
+		Expect([]interface{}{[]byte("0-0"), []interface{}{streamEntry("2-0", data)}})
+	ackCmd := conn.Command("XACK", streamStorage.key, streamStorage.group, "1-0").Expect(int64(1))
+	delCmd := conn.Command("XDEL", streamStorage.key, "1-0").Expect(int64(0))
+	defer conn.Clear()
+
+	id, result, err := streamStorage.reserve(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "2-0", id)
+	assert.Equal(t, data, result)
+	assert.Equal(t, 2, conn.Stats(claimCmd))
+	assert.Equal(t, 1, conn.Stats(ackCmd))
+	assert.Equal(t, 1, conn.Stats(delCmd))
+}
+
+func TestRedisStreamStorage_reserve_empty(t *testing.T) {
+	streamStorage := getTestStreamStorage()
+
+	conn := redigomock.NewConn()
+	expectClaim(conn, streamStorage).Expect([]interface{}{[]byte("0-0"), []interface{}{}})
+	expectRead(conn, streamStorage).Expect(nil)
+	defer conn.Clear()
+
+	_, _, err := streamStorage.reserve(conn)
+	assert.Equal(t, ErrStorageIsEmpty, err)
+}
+
+func TestRedisStreamStorage_reserve_error(t *testing.T) {
+	redisErr := errors.New("test redis error")
+	streamStorage := getTestStreamStorage()
+
+	conn := redigomock.NewConn()
+	expectClaim(conn, streamStorage).ExpectError(redisErr)
+	defer conn.Clear()
+
+	_, _, err := streamStorage.reserve(conn)
+	assert.Equal(t, redisErr, err)
+}
+
+func TestRedisStreamStorage_ack(t *testing.T) {
+	streamStorage := getTestStreamStorage()
+
+	conn := redigomock.NewConn()
+	ackCmd := conn.Command("XACK", streamStorage.key, streamStorage.group, "1-0").Expect(int64(1))
+	delCmd := conn.Command("XDEL", streamStorage.key, "1-0").Expect(int64(1))
+	defer conn.Clear()
+
+	assert.NoError(t, streamStorage.ack(conn, "1-0"))
+	assert.Equal(t, 1, conn.Stats(ackCmd))
+	assert.Equal(t, 1, conn.Stats(delCmd))
+}
+
+func TestRedisStreamStorage_len(t *testing.T) {
+	streamStorage := getTestStreamStorage()
+
+	conn := redigomock.NewConn()
+	cmd := conn.Command("XLEN", streamStorage.key).Expect(int64(2))
+	defer conn.Clear()
+
+	n, err := streamStorage.len(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 1, conn.Stats(cmd))
+}
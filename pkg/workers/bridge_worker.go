@@ -12,6 +12,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/health"
 	"github.com/hellofresh/kandalf/pkg/producer"
 	"github.com/hellofresh/kandalf/pkg/storage"
 )
@@ -23,6 +24,8 @@ const (
 var (
 	errMarshalMessage = errors.New("failed to marshal message")
 	errPutToStorage   = errors.New("failed to put message to storage")
+	errSaturated      = errors.New("bridge worker holds max messages in memory")
+	errStopped        = errors.New("bridge worker is stopped")
 )
 
 // BridgeWorker contains data for bridge worker that does the actual job - handles messages transfer
@@ -35,101 +38,493 @@ type BridgeWorker struct {
 	producer    producer.Producer
 	statsClient client.Client
 
-	cache             []*producer.Message
-	lastFlush         time.Time
-	readStorageTicker *time.Ticker
+	clock         clock
+	buffers       []*buffer
+	buffersByKey  map[string]*buffer
+	wakeup        chan struct{}
+	replay        chan struct{}
+	storageTicker ticker
+	done          <-chan struct{}
+	stop          chan struct{}
+	stopOnce      sync.Once
+	draining      chan struct{}
+	drainOnce     sync.Once
+	loopDone      chan struct{}
+	inFlight      sync.WaitGroup
+
+	// held and heldBytes count messages that are cached or being published
+	held          int
+	heldBytes     int
+	saturated     bool
+	capacityFreed chan struct{}
+	closed        bool
 }
 
 // NewBridgeWorker creates instance of BridgeWorker
 func NewBridgeWorker(config config.WorkerConfig, storage storage.PersistentStorage, producer producer.Producer, statsClient client.Client) (*BridgeWorker, error) {
-	return &BridgeWorker{config: config, storage: storage, producer: producer, statsClient: statsClient}, nil
+	return &BridgeWorker{
+		config:        config,
+		storage:       storage,
+		producer:      producer,
+		statsClient:   statsClient,
+		clock:         realClock{},
+		buffersByKey:  make(map[string]*buffer),
+		wakeup:        make(chan struct{}, 1),
+		replay:        make(chan struct{}, 1),
+		capacityFreed: make(chan struct{}),
+		stop:          make(chan struct{}),
+		draining:      make(chan struct{}),
+	}, nil
 }
 
-// Execute runs the service logic once in sync way
+// Execute runs the service logic once in sync way, every buffer that is full or reached its flush timeout is flushed
 func (w *BridgeWorker) Execute() {
 	w.Lock()
 	defer w.Unlock()
 
-	if len(w.cache) >= w.config.CacheSize || time.Now().Sub(w.lastFlush) >= w.config.CacheFlushTimeout {
-		log.WithFields(log.Fields{"len": len(w.cache), "last_flush": w.lastFlush}).
-			Debug("Flushing worker cache to Kafka")
+	now := w.clock.Now()
+	for _, buf := range w.buffers {
+		reason := buf.flushReason(now)
+		if reason == "" && w.saturated && len(buf.messages) > 0 {
+			// publish everything as soon as possible to free memory
+			reason = flushReasonSaturated
+		}
+		if reason == "" {
+			continue
+		}
+
+		w.flushBuffer(buf, reason)
+	}
+}
 
-		if len(w.cache) > 0 {
-			// copy workers cache to local cache to avoid long locking for worker cache,
-			// as all incoming messages will be waiting for network communication with kafka/storage
-			messages := make([]*producer.Message, len(w.cache))
-			copy(messages, w.cache)
-			w.cache = []*producer.Message{}
+// Flush publishes messages of all the buffers right away no matter their size and flush timeout,
+// stopped worker has nothing to flush
+func (w *BridgeWorker) Flush() {
+	w.Lock()
+	defer w.Unlock()
+
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
 
-			go w.publishMessages(messages)
+	for _, buf := range w.buffers {
+		if len(buf.messages) > 0 {
+			w.flushBuffer(buf, flushReasonForced)
 		}
-		w.lastFlush = time.Now()
 	}
 }
 
-// Go runs the service forever in async way in go-routine
+// flushBuffer publishes buffer messages in background, it must be called under worker lock
+func (w *BridgeWorker) flushBuffer(buf *buffer, reason string) {
+	log.WithFields(log.Fields{"buffer": buf.key, "len": len(buf.messages), "bytes": buf.bytes, "reason": reason}).
+		Debug("Flushing worker buffer")
+	w.statsClient.TrackMetric(statsWorkerSection, bucket.NewMetricOperation("buffer-flush", buf.key, reason))
+
+	// buffer messages are published in background to avoid long locking for worker buffers,
+	// as all incoming messages will be waiting for network communication with kafka/storage
+	w.inFlight.Add(1)
+	go func(messages []*producer.Message) {
+		defer w.inFlight.Done()
+		w.publishMessages(messages)
+	}(buf.take())
+	w.trackBuffer(buf)
+}
+
+// Replay makes worker loop read messages from storage right away instead of waiting for the storage read timeout,
+// replay that is already requested and not started yet is not requested twice
+func (w *BridgeWorker) Replay() {
+	select {
+	case w.replay <- struct{}{}:
+	default:
+	}
+}
+
+// Go runs the service forever in async way in go-routine. Worker sleeps until one of the events happens:
+// buffer is full, buffer flush timeout is over or it is time to read messages from storage.
 func (w *BridgeWorker) Go(ctx context.Context) {
-	w.readStorageTicker = time.NewTicker(w.config.StorageReadTimeout)
+	loopDone := make(chan struct{})
+	w.Lock()
+	w.done = ctx.Done()
+	w.loopDone = loopDone
+	w.Unlock()
+
+	flushTimer := w.clock.NewTimer(w.nextFlushIn())
+	w.storageTicker = w.clock.NewTicker(w.config.StorageReadTimeout)
 
 	go func() {
+		defer close(loopDone)
+		defer flushTimer.Stop()
+
+		// messages stored by previous runs are not waiting for the first tick
+		w.populateCacheFromStorage()
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-w.readStorageTicker.C:
-				w.populateCacheFromStorage()
-			default:
+			case <-w.stop:
+				return
+			case <-w.wakeup:
 				w.Execute()
+				resetTimer(flushTimer, w.nextFlushIn())
+			case <-flushTimer.C():
+				w.Execute()
+				flushTimer.Reset(w.nextFlushIn())
+			case <-w.storageTicker.C():
+				w.populateCacheFromStorage()
+			case <-w.replay:
+				log.Info("Replaying messages from storage on demand")
+				w.populateCacheFromStorage()
 			}
-
-			// Prevent CPU overload
-			log.WithField("timeout", w.config.CycleTimeout.String()).Debug("Bridge worker is going to sleep for a while")
-			time.Sleep(w.config.CycleTimeout)
 		}
 	}()
 }
 
-// Close closes worker resources
+// nextFlushIn returns time left till the earliest buffer flush timeout is over
+func (w *BridgeWorker) nextFlushIn() time.Duration {
+	w.Lock()
+	defer w.Unlock()
+
+	now := w.clock.Now()
+	next := w.config.CacheFlushTimeout
+	for _, buf := range w.buffers {
+		if len(buf.messages) > 0 && buf.flushIn(now) < next {
+			next = buf.flushIn(now)
+		}
+	}
+
+	return next
+}
+
+// StopAdmission stops waiting for room in memory, so consumers blocked by backpressure are released right away
+// and messages that do not fit are rejected. Worker keeps publishing messages it holds, it is called on shutdown
+// before consumers are stopped, so waiting for consumers does not take the time of publishing.
+func (w *BridgeWorker) StopAdmission() {
+	w.drainOnce.Do(func() { close(w.draining) })
+}
+
+// Close closes worker resources waiting for all the in-flight messages to be published
 func (w *BridgeWorker) Close() error {
+	return w.Shutdown(context.Background())
+}
+
+// Shutdown stops the worker and closes its producer and storage. Worker loop is stopped first, then worker waits
+// for in-flight messages to be published until context is done, closes producer and stores all the messages left
+// in memory. Consumers must be stopped before, so no new messages are coming to the worker.
+func (w *BridgeWorker) Shutdown(ctx context.Context) error {
 	log.Info("Closing bridge worker, will handle storage close either")
 
-	// stop storage reader
-	w.readStorageTicker.Stop()
+	w.stopOnce.Do(func() { close(w.stop) })
+	if w.storageTicker != nil {
+		w.storageTicker.Stop()
+	}
+
+	w.Lock()
+	loopDone := w.loopDone
+	w.Unlock()
+	if loopDone != nil {
+		<-loopDone
+	}
+
+	if err := waitGroup(ctx, &w.inFlight); err != nil {
+		log.WithError(err).Warn("Bridge worker did not finish publishing in time, closing producer")
+	}
+
+	// producer reports results of all the pending messages on close, so failed messages are stored or returned
+	// to the cache before the cache is stored
+	if err := w.producer.Close(); err != nil {
+		log.WithError(err).Error("Got error on closing producer")
+	}
+	if err := waitGroup(ctx, &w.inFlight); err != nil {
+		log.WithError(err).Error("Bridge worker did not finish publishing in time, results of in-flight messages are ignored")
+	}
 
-	// lock cache and save all unhandled messages to storage for further processing
-	// do not unlock cache anymore as we're closing everything
+	// save all unhandled messages to storage for further processing, closed worker does not cache messages anymore
 	w.Lock()
-	log.WithField("len", len(w.cache)).Info("Storing unhandled messages to storage")
-	for _, msg := range w.cache {
-		// do not handle errors here as there is nothing we can do with errors at this point
-		w.storeMessage(msg)
+	defer w.Unlock()
+	w.closed = true
+
+	var messages []*producer.Message
+	for _, buf := range w.buffers {
+		messages = append(messages, buf.take()...)
+	}
+	log.WithField("len", len(messages)).Info("Storing unhandled messages to storage")
+	for _, msg := range messages {
+		// there is nothing we can do with storage errors at this point except requeue message in the source
+		if err := w.storeMessage(msg); err != nil {
+			w.nackMessage(msg, true)
+			continue
+		}
+		w.ackMessage(msg)
 	}
 
 	return w.storage.Close()
 }
 
-// MessageHandler is a handler function for new messages from AMQP
-func (w *BridgeWorker) MessageHandler(body []byte, pipe config.Pipe) error {
-	return w.cacheMessage(producer.NewMessage(body, pipe.KafkaTopic))
+// waitGroup waits for wait group counter to become zero or for the context to be done
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (w *BridgeWorker) cacheMessage(msg *producer.Message) error {
+// CacheHealth reports number and size of messages worker holds in memory and number of messages in every buffer,
+// worker is degraded while it is saturated
+func (w *BridgeWorker) CacheHealth() health.Component {
 	w.Lock()
 	defer w.Unlock()
 
-	w.cache = append(w.cache, msg)
+	buffers := make(map[string]int, len(w.buffers))
+	for _, buf := range w.buffers {
+		buffers[buf.key] = len(buf.messages)
+	}
+
+	details := map[string]interface{}{"messages": w.held, "bytes": w.heldBytes, "buffers": buffers}
+	if w.closed {
+		return health.Degraded(errStopped, details)
+	}
+	if w.saturated {
+		return health.Degraded(errSaturated, details)
+	}
+
+	return health.Up(details)
+}
+
+// BufferState is a state of worker buffer
+type BufferState struct {
+	// Messages is a number of messages waiting in buffer to be flushed
+	Messages int `json:"messages"`
+	// Bytes is a total size of buffer messages
+	Bytes int `json:"bytes"`
+}
+
+// Buffers returns state of every worker buffer by its key, see config.Pipe.BufferKey
+func (w *BridgeWorker) Buffers() map[string]BufferState {
+	w.Lock()
+	defer w.Unlock()
+
+	buffers := make(map[string]BufferState, len(w.buffers))
+	for _, buf := range w.buffers {
+		buffers[buf.key] = BufferState{Messages: len(buf.messages), Bytes: buf.bytes}
+	}
+
+	return buffers
+}
+
+// StorageHealth reports persistent storage availability and number of messages waiting in it to be published,
+// storage that is not able to report its state is considered to be up
+func (w *BridgeWorker) StorageHealth() health.Component {
+	monitoredStorage, ok := w.storage.(storage.MonitoredStorage)
+	if !ok {
+		return health.Up(nil)
+	}
+
+	if err := monitoredStorage.Ping(); err != nil {
+		return health.Degraded(err, nil)
+	}
+
+	backlog, err := monitoredStorage.Len()
+	if err != nil {
+		return health.Degraded(err, nil)
+	}
+
+	return health.Up(map[string]interface{}{"backlog": backlog})
+}
+
+// MessageHandler is a handler function for new messages from AMQP.
+// In "at-least-once" delivery mode message is acknowledged only after it is published or stored,
+// otherwise it is acknowledged right after it is cached.
+func (w *BridgeWorker) MessageHandler(body []byte, headers map[string]string, pipe config.Pipe, acknowledger producer.Acknowledger) error {
+	msg := producer.NewMessage(body, pipe.KafkaTopic)
+	msg.Headers = filterHeaders(headers, pipe.KafkaHeadersMapping())
+	msg.Partition = pipe.KafkaPartition
+	msg.URL = pipe.HTTPURL
+
+	key, err := messageKey(pipe, body, headers)
+	if err != nil {
+		log.WithError(err).WithField("msg", msg.String()).Warn("Failed to get message key, sending message without key")
+	}
+	msg.Key = key
+
+	bufferConfig := pipe.Buffer(w.config.Buffer())
+	if w.config.DeliveryMode == config.DeliveryModeAtLeastOnce {
+		msg.SetAcknowledger(acknowledger)
+		return w.admitMessage(msg, &bufferConfig)
+	}
+
+	if err := w.admitMessage(msg, &bufferConfig); err != nil {
+		return err
+	}
+	if err := acknowledger.Ack(); err != nil {
+		log.WithError(err).WithField("msg", msg.String()).Error("Failed to acknowledge message")
+	}
+
+	return nil
+}
+
+// filterHeaders leaves only whitelisted headers renaming them according to mapping,
+// all headers are left as is if mapping is nil
+func filterHeaders(headers map[string]string, mapping map[string]string) map[string]string {
+	if mapping == nil || len(headers) == 0 {
+		return headers
+	}
+
+	result := make(map[string]string, len(mapping))
+	for name, value := range headers {
+		if kafkaName, ok := mapping[name]; ok {
+			result[kafkaName] = value
+		}
+	}
+
+	return result
+}
+
+// cacheMessage puts message to its buffer. Buffer settings are updated if they are given, otherwise buffer
+// keeps its settings, e.g. for messages read from storage, or gets default ones if it does not exist yet.
+func (w *BridgeWorker) cacheMessage(msg *producer.Message, bufferConfig *config.BufferConfig) error {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.cacheMessageLocked(msg, bufferConfig)
+}
+
+// admitMessage caches consumed message applying backpressure when worker is saturated: it either waits
+// for worker to free memory or returns error right away, so the message is rejected and requeued
+func (w *BridgeWorker) admitMessage(msg *producer.Message, bufferConfig *config.BufferConfig) error {
+	w.Lock()
+	defer w.Unlock()
+
+	for w.saturated {
+		w.statsClient.TrackMetric(statsWorkerSection, bucket.NewMetricOperation("cache", "backpressure", w.config.Backpressure))
+		if w.config.Backpressure == config.BackpressureNack {
+			return errSaturated
+		}
+
+		capacityFreed, done := w.capacityFreed, w.done
+		w.Unlock()
+		select {
+		case <-capacityFreed:
+			w.Lock()
+		case <-done:
+			w.Lock()
+			return errStopped
+		case <-w.stop:
+			w.Lock()
+			return errStopped
+		case <-w.draining:
+			w.Lock()
+			return errStopped
+		}
+	}
+
+	return w.cacheMessageLocked(msg, bufferConfig)
+}
+
+func (w *BridgeWorker) cacheMessageLocked(msg *producer.Message, bufferConfig *config.BufferConfig) error {
+	if w.closed {
+		return errStopped
+	}
+
+	key := bufferKey(msg)
+	buf, ok := w.buffersByKey[key]
+	if !ok {
+		buf = newBuffer(key, w.config.Buffer())
+		w.buffers = append(w.buffers, buf)
+		w.buffersByKey[key] = buf
+	}
+	if bufferConfig != nil {
+		buf.config = *bufferConfig
+	}
+
+	// worker loop is woken up to flush full buffer or to schedule flush of the buffer that is not empty anymore
+	wakeup := len(buf.messages) == 0
+	buf.add(msg, w.clock.Now())
+	if wakeup || buf.full() {
+		select {
+		case w.wakeup <- struct{}{}:
+		default:
+			// signal is already pending
+		}
+	}
 
 	operation := bucket.NewMetricOperation("cache", "add", msg.Topic)
 	w.statsClient.TrackOperation(statsWorkerSection, operation, nil, true)
+	w.trackBuffer(buf)
+
+	w.held++
+	w.heldBytes += len(msg.Body)
+	w.updateSaturation()
 
 	return nil
 }
 
+// releaseMessage stops counting message held in memory, it is called once message publishing is over
+func (w *BridgeWorker) releaseMessage(msg *producer.Message) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.held--
+	w.heldBytes -= len(msg.Body)
+	w.updateSaturation()
+}
+
+// updateSaturation checks if worker holds max messages or bytes in memory and reports saturation state changes,
+// it must be called under worker lock
+func (w *BridgeWorker) updateSaturation() {
+	saturated := (w.config.MaxMessages > 0 && w.held >= w.config.MaxMessages) ||
+		(w.config.MaxBytes > 0 && w.heldBytes >= w.config.MaxBytes)
+	if saturated == w.saturated {
+		return
+	}
+	w.saturated = saturated
+
+	fields := log.Fields{"messages": w.held, "bytes": w.heldBytes}
+	operation := bucket.NewMetricOperation("cache", "saturated")
+	if saturated {
+		log.WithFields(fields).Warn("Bridge worker holds max messages in memory, applying backpressure")
+		w.statsClient.TrackState(statsWorkerSection, operation, 1)
+
+		// wake up worker loop to flush all the buffers
+		select {
+		case w.wakeup <- struct{}{}:
+		default:
+		}
+		return
+	}
+
+	log.WithFields(fields).Info("Bridge worker freed memory, releasing backpressure")
+	w.statsClient.TrackState(statsWorkerSection, operation, 0)
+
+	close(w.capacityFreed)
+	w.capacityFreed = make(chan struct{})
+}
+
+func (w *BridgeWorker) trackBuffer(buf *buffer) {
+	w.statsClient.TrackState(statsWorkerSection, bucket.NewMetricOperation("buffer", "messages", buf.key), len(buf.messages))
+	w.statsClient.TrackState(statsWorkerSection, bucket.NewMetricOperation("buffer", "bytes", buf.key), buf.bytes)
+}
+
 func (w *BridgeWorker) populateCacheFromStorage() {
 	var errorsCount int
 
 	log.Debug("Populating cache from storage")
 	for {
+		if w.isSaturated() {
+			log.Debug("Bridge worker is saturated, stopping reading from storage")
+			break
+		}
+
 		if errorsCount >= w.config.StorageMaxErrors {
 			log.WithField("errors_count", errorsCount).
 				Error("Got several errors in a row while reading from storage, stopping reading")
@@ -137,7 +532,7 @@ func (w *BridgeWorker) populateCacheFromStorage() {
 		}
 
 		operation := bucket.NewMetricOperation("storage", "get")
-		storageMsg, err := w.storage.Get()
+		storageMsg, acknowledger, err := w.readStorage()
 		if err != nil {
 			if err == storage.ErrStorageIsEmpty {
 				break
@@ -156,32 +551,116 @@ func (w *BridgeWorker) populateCacheFromStorage() {
 		if err != nil {
 			log.WithError(err).Error("Failed to unmarshal message from persistent storage")
 			w.statsClient.TrackOperation(statsWorkerSection, operation, nil, false)
+			// there is no way to handle broken message, so remove it from storage not to read it over and over again
+			if acknowledger != nil {
+				if err = acknowledger.Nack(false); err != nil {
+					log.WithError(err).Error("Failed to remove broken message from persistent storage")
+				}
+			}
 			continue
 		}
 		w.statsClient.TrackOperation(statsWorkerSection, operation, nil, true)
 
-		w.cacheMessage(msg)
+		if acknowledger != nil {
+			msg.SetAcknowledger(acknowledger)
+		}
+		msg.Replayed = true
+		w.cacheMessage(msg, nil)
+	}
+}
+
+func (w *BridgeWorker) isSaturated() bool {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.saturated
+}
+
+// readStorage reads message from storage, if storage supports acknowledgements message is only reserved
+// and stays in storage until returned acknowledger confirms it is handled
+func (w *BridgeWorker) readStorage() ([]byte, storage.Acknowledger, error) {
+	if acknowledgingStorage, ok := w.storage.(storage.AcknowledgingStorage); ok {
+		return acknowledgingStorage.Reserve()
 	}
+
+	data, err := w.storage.Get()
+	return data, nil, err
 }
 
+// publishMessages publishes messages in a single batch, only failed messages are moved to storage.
+// Producers that can publish asynchronously handle every message as soon as its publishing result is known.
 func (w *BridgeWorker) publishMessages(messages []*producer.Message) {
-	for _, msg := range messages {
-		err := w.producer.Publish(*msg)
-		if err != nil {
+	if asyncProducer, ok := w.producer.(producer.AsyncProducer); ok {
+		for _, msg := range messages {
+			msg := msg
+			w.inFlight.Add(1)
+			asyncProducer.PublishAsync(*msg, func(err error) {
+				defer w.inFlight.Done()
+				w.handlePublishResult(msg, err)
+			})
+		}
+		return
+	}
+
+	batch := make([]producer.Message, len(messages))
+	for i, msg := range messages {
+		batch[i] = *msg
+	}
+
+	batchErr := w.producer.PublishBatch(batch)
+	for i, msg := range messages {
+		w.handlePublishResult(msg, producer.MessageError(batchErr, i))
+	}
+}
+
+// handlePublishResult acknowledges published message, failed message is moved to storage
+func (w *BridgeWorker) handlePublishResult(msg *producer.Message, err error) {
+	// message is either handled or returned to cache, where it is counted again
+	w.releaseMessage(msg)
+
+	if err == nil {
+		w.ackMessage(msg)
+		return
+	}
+
+	log.WithError(err).WithField("msg", msg.String()).
+		Warning("Failed to publish messages to Kafka, moving to storage")
+
+	if err = w.storeMessage(msg); err != nil {
+		if err == errMarshalMessage {
+			w.nackMessage(msg, false)
+		} else if err == errPutToStorage {
+			w.returnMessage(msg)
+		} else {
 			log.WithError(err).WithField("msg", msg.String()).
-				Warning("Failed to publish messages to Kafka, moving to storage")
-
-			if err = w.storeMessage(msg); err != nil {
-				if err == errMarshalMessage {
-					continue
-				} else if err == errPutToStorage {
-					w.cacheMessage(msg)
-				} else {
-					log.WithError(err).WithField("msg", msg.String()).
-						Error("Unhandled storage error")
-				}
-			}
+				Error("Unhandled storage error")
 		}
+		return
+	}
+	w.ackMessage(msg)
+}
+
+// returnMessage gives message back to its source if the source waits for confirmation,
+// otherwise message is returned to cache for further processing
+func (w *BridgeWorker) returnMessage(msg *producer.Message) {
+	if msg.HasAcknowledger() {
+		w.nackMessage(msg, true)
+		return
+	}
+	if err := w.cacheMessage(msg, nil); err != nil {
+		log.WithError(err).WithField("msg", msg.String()).Error("Failed to return message to cache, message is lost")
+	}
+}
+
+func (w *BridgeWorker) ackMessage(msg *producer.Message) {
+	if err := msg.Ack(); err != nil {
+		log.WithError(err).WithField("msg", msg.String()).Error("Failed to acknowledge message")
+	}
+}
+
+func (w *BridgeWorker) nackMessage(msg *producer.Message, requeue bool) {
+	if err := msg.Nack(requeue); err != nil {
+		log.WithError(err).WithField("msg", msg.String()).Error("Failed to reject message")
 	}
 }
 
@@ -197,7 +676,12 @@ func (w *BridgeWorker) storeMessage(msg *producer.Message) error {
 		return errMarshalMessage
 	}
 
-	err = w.storage.Put(data)
+	// replayed message is put back to the read end of the storage if possible, so it keeps its order
+	if requeueingStorage, ok := w.storage.(storage.RequeueingStorage); ok && msg.Replayed {
+		err = requeueingStorage.Requeue(data)
+	} else {
+		err = w.storage.Put(data)
+	}
 
 	operation = bucket.NewMetricOperation("storage", "set")
 	w.statsClient.TrackOperation(statsWorkerSection, operation, nil, err == nil)
@@ -1,6 +1,7 @@
 package workers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,13 +10,25 @@ import (
 
 	"github.com/gofrs/uuid"
 	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/health"
 	"github.com/hellofresh/kandalf/pkg/producer"
 	"github.com/hellofresh/kandalf/pkg/storage"
 	"github.com/hellofresh/stats-go"
 	"github.com/hellofresh/stats-go/client"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// cachedMessages returns messages of all the buffers, it must be called under worker lock
+func (w *BridgeWorker) cachedMessages() []*producer.Message {
+	var messages []*producer.Message
+	for _, buf := range w.buffers {
+		messages = append(messages, buf.messages...)
+	}
+
+	return messages
+}
+
 type mockGetResult struct {
 	data []byte
 	err  error
@@ -56,13 +69,37 @@ func (s *mockStorage) Close() error {
 	return s.closeResult
 }
 
+type mockReserveResult struct {
+	data         []byte
+	acknowledger *mockAcknowledger
+}
+
+type mockAcknowledgingStorage struct {
+	mockStorage
+
+	reserveResult []mockReserveResult
+}
+
+func (s *mockAcknowledgingStorage) Reserve() ([]byte, storage.Acknowledger, error) {
+	if len(s.reserveResult) == 0 {
+		return nil, nil, storage.ErrStorageIsEmpty
+	}
+
+	result := s.reserveResult[0]
+	s.reserveResult = s.reserveResult[1:]
+	return result.data, result.acknowledger, nil
+}
+
 type mockProducer struct {
 	t *testing.T
 
 	publishAssertParam []producer.Message
 	publishResult      []error
 
-	publishCalled int
+	publishBatchResult error
+
+	publishCalled      int
+	publishBatchCalled int
 }
 
 func (p *mockProducer) Publish(msg producer.Message) error {
@@ -75,10 +112,70 @@ func (p *mockProducer) Publish(msg producer.Message) error {
 	return p.publishResult[methodCall]
 }
 
+func (p *mockProducer) PublishBatch(messages []producer.Message) error {
+	p.publishBatchCalled++
+	if p.publishBatchResult != nil {
+		return p.publishBatchResult
+	}
+
+	batchErr := &producer.BatchError{Errors: make(map[int]error)}
+	for i, msg := range messages {
+		if err := p.Publish(msg); err != nil {
+			batchErr.Errors[i] = err
+		}
+	}
+
+	if len(batchErr.Errors) == 0 {
+		return nil
+	}
+	return batchErr
+}
+
 func (p *mockProducer) Close() error {
 	return nil
 }
 
+type mockAsyncProducer struct {
+	mockProducer
+}
+
+func (p *mockAsyncProducer) PublishAsync(msg producer.Message, done func(err error)) {
+	done(p.Publish(msg))
+}
+
+type mockAcknowledger struct {
+	acked    int
+	nacked   int
+	requeued int
+}
+
+func (a *mockAcknowledger) Ack() error {
+	a.acked++
+	return nil
+}
+
+func (a *mockAcknowledger) Nack(requeue bool) error {
+	a.nacked++
+	if requeue {
+		a.requeued++
+	}
+	return nil
+}
+
+func generateTopicMessages(n int, topic string) []*producer.Message {
+	result := generateRandomMessages(n)
+	for _, msg := range result {
+		msg.Topic = topic
+	}
+	return result
+}
+
+func cacheMessages(worker *BridgeWorker, messages []*producer.Message) {
+	for _, msg := range messages {
+		worker.cacheMessage(msg, nil)
+	}
+}
+
 func generateRandomMessages(n int) []*producer.Message {
 	result := make([]*producer.Message, n)
 	for i := 0; i < n; i++ {
@@ -97,20 +194,25 @@ func TestBridgeWorker_MessageHandler(t *testing.T) {
 
 	messages := generateRandomMessages(messagesToPublish)
 	worker, _ := NewBridgeWorker(workerConfig, mockStorage, mockProducer, statsClient)
+	acknowledger := &mockAcknowledger{}
 	for _, msg := range messages {
-		worker.MessageHandler(msg.Body, config.Pipe{KafkaTopic: msg.Topic})
+		worker.MessageHandler(msg.Body, nil, config.Pipe{KafkaTopic: msg.Topic}, acknowledger)
 	}
 
+	// at-most-once delivery mode acknowledges messages right after caching them
+	assert.Equal(t, messagesToPublish, acknowledger.acked)
+	assert.Equal(t, 0, acknowledger.nacked)
+
 	memoryStats, _ := statsClient.(*client.Memory)
 	assert.Equal(t, messagesToPublish, memoryStats.CountMetrics[fmt.Sprintf("total.%s", statsWorkerSection)])
 	assert.Equal(t, messagesToPublish, memoryStats.CountMetrics[fmt.Sprintf("total.%s-ok", statsWorkerSection)])
 	assert.Equal(t, 0, memoryStats.CountMetrics[fmt.Sprintf("total.%s-fail", statsWorkerSection)])
 
-	assert.Equal(t, messagesToPublish, len(worker.cache))
+	assert.Equal(t, messagesToPublish, len(worker.cachedMessages()))
 	for i, msg := range messages {
-		assert.Equal(t, msg.Topic, worker.cache[i].Topic)
-		assert.Equal(t, msg.Body, worker.cache[i].Body)
-		assert.NotEqual(t, msg.ID.String(), worker.cache[i].ID.String())
+		assert.Equal(t, msg.Topic, worker.cachedMessages()[i].Topic)
+		assert.Equal(t, msg.Body, worker.cachedMessages()[i].Body)
+		assert.NotEqual(t, msg.ID.String(), worker.cachedMessages()[i].ID.String())
 
 		assert.Equal(t, 1, memoryStats.CountMetrics[fmt.Sprintf("%s.cache.add.%s", statsWorkerSection, msg.Topic)])
 		assert.Equal(t, 1, memoryStats.CountMetrics[fmt.Sprintf("%s-ok.cache.add.%s", statsWorkerSection, msg.Topic)])
@@ -118,6 +220,143 @@ func TestBridgeWorker_MessageHandler(t *testing.T) {
 	}
 }
 
+func TestBridgeWorker_MessageHandler_atLeastOnce(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+	worker.config.DeliveryMode = config.DeliveryModeAtLeastOnce
+
+	mockProducer := &mockProducer{t: t}
+	worker.producer = mockProducer
+
+	messagesCount := 3
+	messages := generateRandomMessages(messagesCount)
+	acknowledgers := make([]*mockAcknowledger, messagesCount)
+	for i, msg := range messages {
+		acknowledgers[i] = &mockAcknowledger{}
+		err := worker.MessageHandler(msg.Body, nil, config.Pipe{KafkaTopic: msg.Topic}, acknowledgers[i])
+		assert.NoError(t, err)
+	}
+
+	// messages are only cached, so if application crashes at this point
+	// they are still unacknowledged and will be redelivered by RabbitMQ
+	assert.Equal(t, messagesCount, len(worker.cachedMessages()))
+	for _, acknowledger := range acknowledgers {
+		assert.Equal(t, 0, acknowledger.acked)
+		assert.Equal(t, 0, acknowledger.nacked)
+	}
+
+	mockProducer.publishAssertParam = make([]producer.Message, messagesCount)
+	mockProducer.publishResult = make([]error, messagesCount)
+	for i, msg := range worker.cachedMessages() {
+		mockProducer.publishAssertParam[i] = *msg
+	}
+
+	worker.publishMessages(worker.cachedMessages())
+	for _, acknowledger := range acknowledgers {
+		assert.Equal(t, 1, acknowledger.acked)
+		assert.Equal(t, 0, acknowledger.nacked)
+	}
+}
+
+func TestBridgeWorker_publishMessages_atLeastOnce(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+
+	mockProducer := &mockProducer{t: t}
+	mockStorage := &mockStorage{t: t}
+
+	worker.producer = mockProducer
+	worker.storage = mockStorage
+
+	messagesCount := 3
+	messages := generateRandomMessages(messagesCount)
+	acknowledgers := make([]*mockAcknowledger, messagesCount)
+
+	mockProducer.publishAssertParam = make([]producer.Message, messagesCount)
+	mockProducer.publishResult = make([]error, messagesCount)
+	for i, msg := range messages {
+		acknowledgers[i] = &mockAcknowledger{}
+		msg.SetAcknowledger(acknowledgers[i])
+		mockProducer.publishAssertParam[i] = *msg
+	}
+
+	// first message is published, second one is stored, third one fails both
+	mockProducer.publishResult[1] = errors.New("error for publish #1")
+	mockProducer.publishResult[2] = errors.New("error for publish #2")
+	mockStorage.putResult = []error{nil, errors.New("error for storage.Put() #1")}
+
+	worker.publishMessages(messages)
+
+	assert.Equal(t, 1, acknowledgers[0].acked)
+	assert.Equal(t, 0, acknowledgers[0].nacked)
+
+	assert.Equal(t, 1, acknowledgers[1].acked)
+	assert.Equal(t, 0, acknowledgers[1].nacked)
+
+	// message that was neither published nor stored is requeued in the source instead of returning to cache
+	assert.Equal(t, 0, acknowledgers[2].acked)
+	assert.Equal(t, 1, acknowledgers[2].nacked)
+	assert.Equal(t, 1, acknowledgers[2].requeued)
+	assert.Equal(t, 0, len(worker.cachedMessages()))
+}
+
+func TestBridgeWorker_Close_atLeastOnce(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+
+	mockStorage := &mockStorage{t: t, putResult: []error{nil, errors.New("some put error")}}
+	worker.storage = mockStorage
+
+	messages := generateRandomMessages(2)
+	acknowledgers := []*mockAcknowledger{{}, {}}
+	for i, msg := range messages {
+		msg.SetAcknowledger(acknowledgers[i])
+	}
+	cacheMessages(worker, messages)
+
+	err := worker.Close()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, acknowledgers[0].acked)
+	assert.Equal(t, 0, acknowledgers[0].nacked)
+
+	assert.Equal(t, 0, acknowledgers[1].acked)
+	assert.Equal(t, 1, acknowledgers[1].requeued)
+}
+
+func TestBridgeWorker_MessageHandler_headers(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+
+	headers := map[string]string{
+		producer.HeaderRoutingKey:    "order.created",
+		producer.HeaderCorrelationID: "correlation-id",
+		"x-tenant":                   "de",
+	}
+
+	err := worker.MessageHandler([]byte("body"), headers, config.Pipe{KafkaTopic: "all-headers"}, &mockAcknowledger{})
+	assert.NoError(t, err)
+
+	pipe := config.Pipe{
+		KafkaTopic:   "whitelisted-headers",
+		KafkaHeaders: []string{producer.HeaderRoutingKey, producer.HeaderCorrelationID + "=correlation-id"},
+	}
+	err = worker.MessageHandler([]byte("body"), headers, pipe, &mockAcknowledger{})
+	assert.NoError(t, err)
+
+	pipe.KafkaKey = config.KafkaKeyRoutingKey
+	pipe.KafkaHeaders = []string{"x-tenant"}
+	err = worker.MessageHandler([]byte("body"), headers, pipe, &mockAcknowledger{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(worker.cachedMessages()))
+	assert.Nil(t, worker.cachedMessages()[0].Key)
+	assert.Equal(t, headers, worker.cachedMessages()[0].Headers)
+	// key is taken from original headers even if the header is not forwarded
+	assert.Equal(t, []byte("order.created"), worker.cachedMessages()[2].Key)
+	assert.Equal(t, map[string]string{"x-tenant": "de"}, worker.cachedMessages()[2].Headers)
+	assert.Equal(t, map[string]string{
+		producer.HeaderRoutingKey: "order.created",
+		"correlation-id":          "correlation-id",
+	}, worker.cachedMessages()[1].Headers)
+}
+
 func TestBridgeWorker_cacheMessage(t *testing.T) {
 	workerConfig := config.WorkerConfig{}
 	statsClient, _ := stats.NewClient("memory://")
@@ -129,11 +368,11 @@ func TestBridgeWorker_cacheMessage(t *testing.T) {
 	messages := generateRandomMessages(messagesToPublish)
 	worker, _ := NewBridgeWorker(workerConfig, mockStorage, mockProducer, statsClient)
 	for _, msg := range messages {
-		worker.cacheMessage(msg)
+		worker.cacheMessage(msg, nil)
 	}
 
-	assert.Equal(t, messagesToPublish, len(worker.cache))
-	assert.Equal(t, messages, worker.cache)
+	assert.Equal(t, messagesToPublish, len(worker.cachedMessages()))
+	assert.Equal(t, messages, worker.cachedMessages())
 
 	memoryStats, _ := statsClient.(*client.Memory)
 	assert.Equal(t, messagesToPublish, memoryStats.CountMetrics[fmt.Sprintf("total.%s", statsWorkerSection)])
@@ -178,9 +417,9 @@ func TestBridgeWorker_Execute_noFlushTimeNoCacheSize(t *testing.T) {
 	mockProducer := &mockProducer{t: t}
 	worker.producer = mockProducer
 
-	worker.lastFlush = time.Now()
-	worker.cache = generateRandomMessages(worker.config.CacheSize - 1)
+	cacheMessages(worker, generateTopicMessages(worker.config.CacheSize-1, "orders"))
 	worker.Execute()
+	assert.Equal(t, worker.config.CacheSize-1, len(worker.cachedMessages()))
 }
 
 func TestBridgeWorker_Execute_noFlushTimeCacheSize(t *testing.T) {
@@ -189,42 +428,79 @@ func TestBridgeWorker_Execute_noFlushTimeCacheSize(t *testing.T) {
 	mockProducer := &mockProducer{t: t}
 	worker.producer = mockProducer
 
-	worker.lastFlush = time.Now()
 	messagesCount := worker.config.CacheSize
-	worker.cache = generateRandomMessages(messagesCount)
+	cacheMessages(worker, generateTopicMessages(messagesCount, "orders"))
 
 	mockProducer.publishAssertParam = make([]producer.Message, messagesCount)
 	mockProducer.publishResult = make([]error, messagesCount)
-	for i, msg := range worker.cache {
+	for i, msg := range worker.cachedMessages() {
 		mockProducer.publishAssertParam[i] = *msg
 		mockProducer.publishResult[i] = nil
 	}
 
-	assert.Equal(t, messagesCount, len(worker.cache))
+	assert.Equal(t, messagesCount, len(worker.cachedMessages()))
 	worker.Execute()
-	assert.Equal(t, 0, len(worker.cache))
+	assert.Equal(t, 0, len(worker.cachedMessages()))
 }
 
 func TestBridgeWorker_Execute_flushTimeNoCacheSize(t *testing.T) {
 	worker := getDefaultBridgeWorker(t)
+	clock := newFakeClock()
+	worker.clock = clock
 
 	mockProducer := &mockProducer{t: t}
 	worker.producer = mockProducer
 
-	worker.lastFlush = time.Time{}
 	messagesCount := worker.config.CacheSize - 1
-	worker.cache = generateRandomMessages(messagesCount)
+	cacheMessages(worker, generateTopicMessages(messagesCount, "orders"))
+	clock.Advance(worker.config.CacheFlushTimeout)
 
 	mockProducer.publishAssertParam = make([]producer.Message, messagesCount)
 	mockProducer.publishResult = make([]error, messagesCount)
-	for i, msg := range worker.cache {
+	for i, msg := range worker.cachedMessages() {
 		mockProducer.publishAssertParam[i] = *msg
 		mockProducer.publishResult[i] = nil
 	}
 
-	assert.Equal(t, messagesCount, len(worker.cache))
+	assert.Equal(t, messagesCount, len(worker.cachedMessages()))
+	worker.Execute()
+	assert.Equal(t, 0, len(worker.cachedMessages()))
+}
+
+func TestBridgeWorker_Execute_buffers(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+	clock := newFakeClock()
+	worker.clock = clock
+	worker.producer = &batchProducer{batches: make(chan []producer.Message, 10)}
+	statsClient := worker.statsClient.(*client.Memory)
+
+	// burst on "orders" topic does not flush "payments" buffer
+	cacheMessages(worker, generateTopicMessages(worker.config.CacheSize, "orders"))
+	cacheMessages(worker, generateTopicMessages(1, "payments"))
+	worker.Execute()
+	require.Len(t, worker.cachedMessages(), 1)
+	assert.Equal(t, "payments", worker.cachedMessages()[0].Topic)
+	assert.Equal(t, 1, statsClient.CountMetrics["worker.buffer-flush.orders.size"])
+	assert.Equal(t, 0, statsClient.StateMetrics["worker.buffer.messages.orders"])
+	assert.Equal(t, 1, statsClient.StateMetrics["worker.buffer.messages.payments"])
+
+	// pipe settings override defaults for the pipe buffer only
+	paymentsPipe := config.Pipe{KafkaTopic: "payments", BufferFlushTimeout: time.Second}
+	require.NoError(t, worker.MessageHandler([]byte("payment"), nil, paymentsPipe, &mockAcknowledger{}))
+	ordersPipe := config.Pipe{KafkaTopic: "orders", BufferMaxBytes: 10}
+	require.NoError(t, worker.MessageHandler([]byte("order"), nil, ordersPipe, &mockAcknowledger{}))
+	assert.Equal(t, 5, statsClient.StateMetrics["worker.buffer.bytes.orders"])
+
+	clock.Advance(time.Second)
+	worker.Execute()
+	require.Len(t, worker.cachedMessages(), 1)
+	assert.Equal(t, "orders", worker.cachedMessages()[0].Topic)
+	assert.Equal(t, 1, statsClient.CountMetrics["worker.buffer-flush.payments.timeout"])
+
+	require.NoError(t, worker.MessageHandler([]byte("order"), nil, ordersPipe, &mockAcknowledger{}))
 	worker.Execute()
-	assert.Equal(t, 0, len(worker.cache))
+	assert.Empty(t, worker.cachedMessages())
+	assert.Equal(t, 1, statsClient.CountMetrics["worker.buffer-flush.orders.bytes"])
 }
 
 func TestNewBridgeWorker_publishMessages(t *testing.T) {
@@ -254,12 +530,72 @@ func TestNewBridgeWorker_publishMessages(t *testing.T) {
 
 	worker.publishMessages(messages)
 
-	// all messages tried to be published
+	// all messages tried to be published in a single batch
+	assert.Equal(t, 1, mockProducer.publishBatchCalled)
 	assert.Equal(t, messagesCount, mockProducer.publishCalled)
 	// two publish errors called storage
 	assert.Equal(t, 2, mockStorage.putCalled)
 	// one failed storage call returned message to cache
-	assert.Equal(t, 1, len(worker.cache))
+	assert.Equal(t, 1, len(worker.cachedMessages()))
+}
+
+func TestNewBridgeWorker_publishMessages_batchError(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+
+	mockProducer := &mockProducer{t: t, publishBatchResult: errors.New("kafka is not available")}
+	mockStorage := &mockStorage{t: t, putResult: []error{nil, nil, nil}}
+
+	worker.producer = mockProducer
+	worker.storage = mockStorage
+
+	messages := generateRandomMessages(3)
+	acknowledger := &mockAcknowledger{}
+	for _, msg := range messages {
+		msg.SetAcknowledger(acknowledger)
+	}
+
+	worker.publishMessages(messages)
+
+	// failed batch moves all the messages to storage
+	assert.Equal(t, 1, mockProducer.publishBatchCalled)
+	assert.Equal(t, 3, mockStorage.putCalled)
+	assert.Equal(t, 3, acknowledger.acked)
+	assert.Equal(t, 0, len(worker.cachedMessages()))
+}
+
+func TestBridgeWorker_publishMessages_async(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+
+	mockProducer := &mockAsyncProducer{mockProducer{t: t}}
+	mockStorage := &mockStorage{t: t, putResult: []error{errors.New("error for storage.Put() #0")}}
+
+	worker.producer = mockProducer
+	worker.storage = mockStorage
+
+	messagesCount := 2
+	messages := generateRandomMessages(messagesCount)
+	acknowledgers := make([]*mockAcknowledger, messagesCount)
+
+	mockProducer.publishAssertParam = make([]producer.Message, messagesCount)
+	mockProducer.publishResult = []error{nil, errors.New("error for publish #1")}
+	for i, msg := range messages {
+		acknowledgers[i] = &mockAcknowledger{}
+		msg.SetAcknowledger(acknowledgers[i])
+		mockProducer.publishAssertParam[i] = *msg
+	}
+
+	worker.publishMessages(messages)
+
+	// every message is handled by its own publishing result, batch is not used
+	assert.Equal(t, 0, mockProducer.publishBatchCalled)
+	assert.Equal(t, 2, mockProducer.publishCalled)
+
+	assert.Equal(t, 1, acknowledgers[0].acked)
+	assert.Equal(t, 0, acknowledgers[0].nacked)
+
+	assert.Equal(t, 0, acknowledgers[1].acked)
+	assert.Equal(t, 1, acknowledgers[1].requeued)
+	assert.Equal(t, 1, mockStorage.putCalled)
 }
 
 func TestBridgeWorker_populateCacheFromStorage(t *testing.T) {
@@ -281,10 +617,13 @@ func TestBridgeWorker_populateCacheFromStorage(t *testing.T) {
 	// second normal message
 	mockStorage.getResult = append(mockStorage.getResult, mockGetResult{jsonData2, nil})
 
-	assert.Equal(t, 0, len(worker.cache))
+	assert.Equal(t, 0, len(worker.cachedMessages()))
 	worker.populateCacheFromStorage()
-	assert.Equal(t, 2, len(worker.cache))
-	assert.Equal(t, normalMessages, worker.cache)
+	assert.Equal(t, 2, len(worker.cachedMessages()))
+	for _, msg := range normalMessages {
+		msg.Replayed = true
+	}
+	assert.Equal(t, normalMessages, worker.cachedMessages())
 }
 
 func TestBridgeWorker_populateCacheFromStorage_maxErrors(t *testing.T) {
@@ -315,10 +654,50 @@ func TestBridgeWorker_populateCacheFromStorage_maxErrors(t *testing.T) {
 	// third normal message, this should never be processed
 	mockStorage.getResult = append(mockStorage.getResult, mockGetResult{jsonData3, nil})
 
-	assert.Equal(t, 0, len(worker.cache))
+	assert.Equal(t, 0, len(worker.cachedMessages()))
+	worker.populateCacheFromStorage()
+	assert.Equal(t, 2, len(worker.cachedMessages()))
+	for _, msg := range normalMessages {
+		msg.Replayed = true
+	}
+	assert.Equal(t, normalMessages[:2], worker.cachedMessages())
+}
+
+func TestBridgeWorker_populateCacheFromStorage_acknowledging(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+
+	mockStorage := &mockAcknowledgingStorage{mockStorage: mockStorage{t: t}}
+	worker.storage = mockStorage
+
+	mockProducer := &mockProducer{t: t}
+	worker.producer = mockProducer
+
+	normalMessages := generateRandomMessages(2)
+	jsonData1, _ := json.Marshal(normalMessages[0])
+	jsonData2, _ := json.Marshal(normalMessages[1])
+
+	acknowledgers := []*mockAcknowledger{{}, {}, {}}
+	mockStorage.reserveResult = []mockReserveResult{
+		{jsonData1, acknowledgers[0]},
+		{[]byte("i no json"), acknowledgers[1]},
+		{jsonData2, acknowledgers[2]},
+	}
+
 	worker.populateCacheFromStorage()
-	assert.Equal(t, 2, len(worker.cache))
-	assert.Equal(t, normalMessages[:2], worker.cache)
+	assert.Equal(t, 2, len(worker.cachedMessages()))
+
+	// broken message is removed from storage right away, others stay reserved until published
+	assert.Equal(t, 0, acknowledgers[0].acked)
+	assert.Equal(t, 1, acknowledgers[1].nacked)
+	assert.Equal(t, 0, acknowledgers[1].requeued)
+	assert.Equal(t, 0, acknowledgers[2].acked)
+
+	mockProducer.publishAssertParam = []producer.Message{*worker.cachedMessages()[0], *worker.cachedMessages()[1]}
+	mockProducer.publishResult = []error{nil, nil}
+	worker.publishMessages(worker.cachedMessages())
+
+	assert.Equal(t, 1, acknowledgers[0].acked)
+	assert.Equal(t, 1, acknowledgers[2].acked)
 }
 
 func TestBridgeWorker_Close(t *testing.T) {
@@ -327,17 +706,16 @@ func TestBridgeWorker_Close(t *testing.T) {
 	errStorageClose := errors.New("some storage error")
 	mockStorage := &mockStorage{t: t, closeResult: errStorageClose}
 	worker.storage = mockStorage
-	worker.readStorageTicker = time.NewTicker(worker.config.StorageReadTimeout)
 
 	messagesCount := 5
 	messages := generateRandomMessages(messagesCount)
 
-	worker.cache = messages
+	cacheMessages(worker, messages)
 	for i := 0; i < len(messages); i++ {
 		mockStorage.putResult = append(mockStorage.putResult, nil)
 	}
 
-	assert.Equal(t, messagesCount, len(worker.cache))
+	assert.Equal(t, messagesCount, len(worker.cachedMessages()))
 	assert.Equal(t, 0, len(mockStorage.putData))
 
 	err := worker.Close()
@@ -364,6 +742,7 @@ func TestBridgeWorker_storeMessage_errors(t *testing.T) {
 	assert.NoError(t, err)
 
 	msg2 := producer.NewMessage([]byte(uuid.Must(uuid.NewV4()).String()), uuid.Must(uuid.NewV4()).String())
+	msg2.Headers = map[string]string{producer.HeaderRoutingKey: "order.created"}
 	err = worker.storeMessage(msg2)
 	assert.Error(t, err)
 	assert.Equal(t, errPutToStorage, err)
@@ -380,3 +759,587 @@ func TestBridgeWorker_storeMessage_errors(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, msg2, msg2Json)
 }
+
+func TestBridgeWorker_MessageHandler_url(t *testing.T) {
+	statsClient, _ := stats.NewClient("memory://")
+	worker, _ := NewBridgeWorker(config.WorkerConfig{}, &mockStorage{}, &mockProducer{}, statsClient)
+
+	pipe := config.Pipe{RabbitQueueName: "kandalf-notifications", HTTPURL: "http://notifications.local/hooks/orders"}
+	assert.NoError(t, worker.MessageHandler([]byte("body"), nil, pipe, &mockAcknowledger{}))
+
+	assert.Len(t, worker.cachedMessages(), 1)
+	assert.Equal(t, "http://notifications.local/hooks/orders", worker.cachedMessages()[0].URL)
+}
+
+// batchProducer reports every published batch to the channel
+type batchProducer struct {
+	batches chan []producer.Message
+}
+
+func (p *batchProducer) Publish(msg producer.Message) error {
+	return p.PublishBatch([]producer.Message{msg})
+}
+
+func (p *batchProducer) PublishBatch(messages []producer.Message) error {
+	p.batches <- messages
+	return nil
+}
+
+func (p *batchProducer) Close() error {
+	return nil
+}
+
+// chanStorage is a storage that can be used concurrently by worker and test
+type chanStorage struct {
+	messages   chan []byte
+	emptyReads chan struct{}
+}
+
+func newChanStorage() *chanStorage {
+	return &chanStorage{messages: make(chan []byte, 10), emptyReads: make(chan struct{}, 10)}
+}
+
+func (s *chanStorage) Put(data []byte) error {
+	s.messages <- data
+	return nil
+}
+
+func (s *chanStorage) Get() ([]byte, error) {
+	select {
+	case data := <-s.messages:
+		return data, nil
+	default:
+		select {
+		case s.emptyReads <- struct{}{}:
+		default:
+		}
+		return nil, storage.ErrStorageIsEmpty
+	}
+}
+
+func (s *chanStorage) Close() error {
+	return nil
+}
+
+func startEventsWorker(t *testing.T, cacheSize int, s storage.PersistentStorage) (*BridgeWorker, *fakeClock, *batchProducer, context.CancelFunc) {
+	workerConfig := config.WorkerConfig{
+		CacheSize:          cacheSize,
+		StorageMaxErrors:   10,
+		CacheFlushTimeout:  time.Minute,
+		StorageReadTimeout: time.Hour,
+	}
+	statsClient, _ := stats.NewClient("noop://")
+	batchProducer := &batchProducer{batches: make(chan []producer.Message, 10)}
+
+	worker, err := NewBridgeWorker(workerConfig, s, batchProducer, statsClient)
+	require.NoError(t, err)
+
+	clock := newFakeClock()
+	worker.clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.Go(ctx)
+
+	return worker, clock, batchProducer, cancel
+}
+
+func receiveBatch(t *testing.T, batches <-chan []producer.Message) []producer.Message {
+	select {
+	case batch := <-batches:
+		return batch
+	case <-time.After(time.Second):
+		t.Fatal("messages are not published")
+		return nil
+	}
+}
+
+func assertNoBatch(t *testing.T, batches <-chan []producer.Message) {
+	select {
+	case batch := <-batches:
+		t.Fatalf("unexpected batch of %d messages is published", len(batch))
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBridgeWorker_Go_cacheFull(t *testing.T) {
+	worker, _, batchProducer, cancel := startEventsWorker(t, 2, newChanStorage())
+	defer cancel()
+
+	pipe := config.Pipe{KafkaTopic: "orders"}
+	require.NoError(t, worker.MessageHandler([]byte("order #1"), nil, pipe, &mockAcknowledger{}))
+	assertNoBatch(t, batchProducer.batches)
+
+	// full cache is flushed right away, clock does not move
+	require.NoError(t, worker.MessageHandler([]byte("order #2"), nil, pipe, &mockAcknowledger{}))
+	batch := receiveBatch(t, batchProducer.batches)
+	require.Len(t, batch, 2)
+	assert.Equal(t, []byte("order #1"), batch[0].Body)
+	assert.Equal(t, []byte("order #2"), batch[1].Body)
+}
+
+func TestBridgeWorker_Go_flushTimeout(t *testing.T) {
+	worker, clock, batchProducer, cancel := startEventsWorker(t, 100, newChanStorage())
+	defer cancel()
+
+	require.NoError(t, worker.MessageHandler([]byte("order #1"), nil, config.Pipe{KafkaTopic: "orders"}, &mockAcknowledger{}))
+
+	clock.Advance(worker.config.CacheFlushTimeout - time.Second)
+	assertNoBatch(t, batchProducer.batches)
+
+	clock.Advance(time.Second)
+	batch := receiveBatch(t, batchProducer.batches)
+	require.Len(t, batch, 1)
+	assert.Equal(t, []byte("order #1"), batch[0].Body)
+
+	// flush timer is restarted after the flush
+	require.NoError(t, worker.MessageHandler([]byte("order #2"), nil, config.Pipe{KafkaTopic: "orders"}, &mockAcknowledger{}))
+	clock.Advance(worker.config.CacheFlushTimeout)
+	batch = receiveBatch(t, batchProducer.batches)
+	require.Len(t, batch, 1)
+	assert.Equal(t, []byte("order #2"), batch[0].Body)
+}
+
+func TestBridgeWorker_Go_storage(t *testing.T) {
+	chanStorage := newChanStorage()
+	storedMsg, _ := json.Marshal(producer.NewMessage([]byte("stored before start"), "orders"))
+	require.NoError(t, chanStorage.Put(storedMsg))
+
+	_, clock, batchProducer, cancel := startEventsWorker(t, 1, chanStorage)
+	defer cancel()
+
+	// messages stored before start are replayed right away
+	batch := receiveBatch(t, batchProducer.batches)
+	require.Len(t, batch, 1)
+	assert.Equal(t, []byte("stored before start"), batch[0].Body)
+
+	select {
+	case <-chanStorage.emptyReads:
+	case <-time.After(time.Second):
+		t.Fatal("storage is not read till the end")
+	}
+
+	storedMsg, _ = json.Marshal(producer.NewMessage([]byte("stored after start"), "orders"))
+	require.NoError(t, chanStorage.Put(storedMsg))
+	assertNoBatch(t, batchProducer.batches)
+
+	clock.Advance(time.Hour)
+	batch = receiveBatch(t, batchProducer.batches)
+	require.Len(t, batch, 1)
+	assert.Equal(t, []byte("stored after start"), batch[0].Body)
+}
+
+func TestBridgeWorker_Go_pipeFlushTimeout(t *testing.T) {
+	worker, clock, batchProducer, cancel := startEventsWorker(t, 100, newChanStorage())
+	defer cancel()
+
+	pipe := config.Pipe{KafkaTopic: "payments", BufferFlushTimeout: time.Second}
+	require.NoError(t, worker.MessageHandler([]byte("payment #1"), nil, pipe, &mockAcknowledger{}))
+	require.NoError(t, worker.MessageHandler([]byte("order #1"), nil, config.Pipe{KafkaTopic: "orders"}, &mockAcknowledger{}))
+
+	// pipe buffer is flushed by its own timeout, long before the default one is over
+	clock.Advance(time.Second)
+	batch := receiveBatch(t, batchProducer.batches)
+	require.Len(t, batch, 1)
+	assert.Equal(t, []byte("payment #1"), batch[0].Body)
+	assertNoBatch(t, batchProducer.batches)
+
+	clock.Advance(worker.config.CacheFlushTimeout)
+	batch = receiveBatch(t, batchProducer.batches)
+	require.Len(t, batch, 1)
+	assert.Equal(t, []byte("order #1"), batch[0].Body)
+}
+
+func newLimitedBridgeWorker(t *testing.T, maxMessages int, backpressure string, statsDSN string) *BridgeWorker {
+	workerConfig := config.WorkerConfig{
+		CacheSize:          100,
+		CacheFlushTimeout:  time.Hour,
+		StorageReadTimeout: time.Hour,
+		StorageMaxErrors:   10,
+		MaxMessages:        maxMessages,
+		Backpressure:       backpressure,
+	}
+	statsClient, _ := stats.NewClient(statsDSN)
+
+	worker, err := NewBridgeWorker(workerConfig, &mockStorage{t: t}, &mockProducer{t: t}, statsClient)
+	require.NoError(t, err)
+
+	return worker
+}
+
+func TestBridgeWorker_MessageHandler_backpressureNack(t *testing.T) {
+	worker := newLimitedBridgeWorker(t, 2, config.BackpressureNack, "memory://")
+	memoryStats := worker.statsClient.(*client.Memory)
+	pipe := config.Pipe{KafkaTopic: "orders"}
+
+	assert.NoError(t, worker.MessageHandler([]byte("order #1"), nil, pipe, &mockAcknowledger{}))
+	assert.NoError(t, worker.MessageHandler([]byte("order #2"), nil, pipe, &mockAcknowledger{}))
+	assert.Equal(t, 1, memoryStats.StateMetrics["worker.cache.saturated.-"])
+
+	acknowledger := &mockAcknowledger{}
+	assert.Equal(t, errSaturated, worker.MessageHandler([]byte("order #3"), nil, pipe, acknowledger))
+	assert.Equal(t, 0, acknowledger.acked)
+	assert.Equal(t, 1, memoryStats.CountMetrics["worker.cache.backpressure.nack"])
+	assert.Len(t, worker.cachedMessages(), 2)
+
+	// published message frees memory for the next one
+	worker.handlePublishResult(worker.cachedMessages()[0], nil)
+	assert.Equal(t, 0, memoryStats.StateMetrics["worker.cache.saturated.-"])
+	assert.NoError(t, worker.MessageHandler([]byte("order #3"), nil, pipe, acknowledger))
+	assert.Equal(t, 1, acknowledger.acked)
+}
+
+func TestBridgeWorker_MessageHandler_backpressureBlock(t *testing.T) {
+	worker := newLimitedBridgeWorker(t, 1, config.BackpressureBlock, "noop://")
+	pipe := config.Pipe{KafkaTopic: "orders"}
+
+	require.NoError(t, worker.MessageHandler([]byte("order #1"), nil, pipe, &mockAcknowledger{}))
+	msg := worker.cachedMessages()[0]
+
+	handled := make(chan error)
+	go func() {
+		handled <- worker.MessageHandler([]byte("order #2"), nil, pipe, &mockAcknowledger{})
+	}()
+
+	select {
+	case <-handled:
+		t.Fatal("message is handled while worker is saturated")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	worker.handlePublishResult(msg, nil)
+	select {
+	case err := <-handled:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("message is not handled after worker freed memory")
+	}
+}
+
+func TestBridgeWorker_MessageHandler_backpressureStopped(t *testing.T) {
+	worker := newLimitedBridgeWorker(t, 1, config.BackpressureBlock, "noop://")
+	pipe := config.Pipe{KafkaTopic: "orders"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.done = ctx.Done()
+
+	require.NoError(t, worker.MessageHandler([]byte("order #1"), nil, pipe, &mockAcknowledger{}))
+
+	handled := make(chan error)
+	go func() {
+		handled <- worker.MessageHandler([]byte("order #2"), nil, pipe, &mockAcknowledger{})
+	}()
+
+	// blocked consumer gives message back when worker is stopped
+	cancel()
+	select {
+	case err := <-handled:
+		assert.Equal(t, errStopped, err)
+	case <-time.After(time.Second):
+		t.Fatal("message handler is not released after worker is stopped")
+	}
+}
+
+func TestBridgeWorker_StopAdmission(t *testing.T) {
+	worker := newLimitedBridgeWorker(t, 1, config.BackpressureBlock, "noop://")
+	pipe := config.Pipe{KafkaTopic: "orders"}
+
+	require.NoError(t, worker.MessageHandler([]byte("order #1"), nil, pipe, &mockAcknowledger{}))
+
+	handled := make(chan error)
+	go func() {
+		handled <- worker.MessageHandler([]byte("order #2"), nil, pipe, &mockAcknowledger{})
+	}()
+
+	// blocked consumer is released on shutdown before worker is stopped, so consumers can be stopped in time
+	worker.StopAdmission()
+	select {
+	case err := <-handled:
+		assert.Equal(t, errStopped, err)
+	case <-time.After(time.Second):
+		t.Fatal("message handler is not released after admission is stopped")
+	}
+
+	// message that does not fit is rejected right away, cached messages are still there to be published
+	assert.Equal(t, errStopped, worker.MessageHandler([]byte("order #3"), nil, pipe, &mockAcknowledger{}))
+	assert.Len(t, worker.cachedMessages(), 1)
+}
+
+func TestBridgeWorker_populateCacheFromStorage_saturated(t *testing.T) {
+	worker := newLimitedBridgeWorker(t, 1, config.BackpressureBlock, "memory://")
+
+	storedMessages := generateRandomMessages(2)
+	jsonData1, _ := json.Marshal(storedMessages[0])
+	jsonData2, _ := json.Marshal(storedMessages[1])
+	mockStorage := &mockStorage{t: t, getResult: []mockGetResult{{jsonData1, nil}, {jsonData2, nil}}}
+	worker.storage = mockStorage
+
+	// storage is not read anymore once worker is saturated, messages stay in storage
+	worker.populateCacheFromStorage()
+	assert.Equal(t, 1, mockStorage.getCalled)
+	assert.Len(t, worker.cachedMessages(), 1)
+}
+
+func TestBridgeWorker_Execute_saturated(t *testing.T) {
+	worker := newLimitedBridgeWorker(t, 2, config.BackpressureBlock, "memory://")
+	worker.producer = &batchProducer{batches: make(chan []producer.Message, 10)}
+	memoryStats := worker.statsClient.(*client.Memory)
+
+	cacheMessages(worker, generateTopicMessages(1, "orders"))
+	worker.Execute()
+	assert.Len(t, worker.cachedMessages(), 1)
+
+	// saturated worker flushes buffers that are neither full nor timed out
+	cacheMessages(worker, generateTopicMessages(1, "payments"))
+	worker.Execute()
+	assert.Empty(t, worker.cachedMessages())
+	assert.Equal(t, 1, memoryStats.CountMetrics["worker.buffer-flush.orders.saturated"])
+	assert.Equal(t, 1, memoryStats.CountMetrics["worker.buffer-flush.payments.saturated"])
+}
+
+// gatedProducer holds published batches until they are released and fails them, so they are moved to storage
+type gatedProducer struct {
+	started chan int
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func newGatedProducer() *gatedProducer {
+	return &gatedProducer{started: make(chan int, 10), release: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (p *gatedProducer) Publish(msg producer.Message) error {
+	return p.PublishBatch([]producer.Message{msg})
+}
+
+func (p *gatedProducer) PublishBatch(messages []producer.Message) error {
+	p.started <- len(messages)
+	<-p.release
+	return errors.New("kafka is not available")
+}
+
+func (p *gatedProducer) Close() error {
+	close(p.closed)
+	return nil
+}
+
+func startShutdownWorker(t *testing.T, s storage.PersistentStorage, p *gatedProducer) (*BridgeWorker, []*mockAcknowledger) {
+	workerConfig := config.WorkerConfig{
+		CacheSize:          2,
+		StorageMaxErrors:   10,
+		CacheFlushTimeout:  time.Minute,
+		StorageReadTimeout: time.Hour,
+		DeliveryMode:       config.DeliveryModeAtLeastOnce,
+	}
+	statsClient, _ := stats.NewClient("noop://")
+
+	worker, err := NewBridgeWorker(workerConfig, s, p, statsClient)
+	require.NoError(t, err)
+	worker.clock = newFakeClock()
+	worker.Go(context.Background())
+
+	// two messages fill the buffer and are published, the third one stays in memory
+	acknowledgers := []*mockAcknowledger{{}, {}, {}}
+	pipe := config.Pipe{KafkaTopic: "orders"}
+	for i, acknowledger := range acknowledgers {
+		require.NoError(t, worker.MessageHandler([]byte(fmt.Sprintf("order #%d", i)), nil, pipe, acknowledger))
+		if i != 1 {
+			continue
+		}
+
+		select {
+		case n := <-p.started:
+			require.Equal(t, 2, n)
+		case <-time.After(time.Second):
+			t.Fatal("messages are not published")
+		}
+	}
+
+	return worker, acknowledgers
+}
+
+func TestBridgeWorker_Shutdown(t *testing.T) {
+	mockStorage := &mockStorage{t: t, putResult: []error{nil, nil, nil}}
+	gatedProducer := newGatedProducer()
+	worker, acknowledgers := startShutdownWorker(t, mockStorage, gatedProducer)
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- worker.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-shutdown:
+		t.Fatal("worker is shut down while messages are being published")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(gatedProducer.release)
+	select {
+	case err := <-shutdown:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("worker is not shut down after messages are published")
+	}
+
+	// every message is stored exactly once and acknowledged, both failed in-flight ones and the cached one
+	require.Len(t, mockStorage.putData, 3)
+	stored := make(map[string]bool)
+	for _, data := range mockStorage.putData {
+		var msg *producer.Message
+		require.NoError(t, json.Unmarshal(data, &msg))
+		stored[string(msg.Body)] = true
+	}
+	assert.Equal(t, map[string]bool{"order #0": true, "order #1": true, "order #2": true}, stored)
+	for _, acknowledger := range acknowledgers {
+		assert.Equal(t, 1, acknowledger.acked)
+		assert.Equal(t, 0, acknowledger.nacked)
+	}
+
+	select {
+	case <-gatedProducer.closed:
+	default:
+		t.Fatal("producer is not closed")
+	}
+}
+
+func TestBridgeWorker_Shutdown_timeout(t *testing.T) {
+	mockStorage := &mockStorage{t: t, putResult: []error{nil}}
+	gatedProducer := newGatedProducer()
+	worker, acknowledgers := startShutdownWorker(t, mockStorage, gatedProducer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, worker.Shutdown(ctx))
+
+	// cached message is stored, in-flight ones are neither stored nor acknowledged, so they are redelivered
+	require.Len(t, mockStorage.putData, 1)
+	var msg *producer.Message
+	require.NoError(t, json.Unmarshal(mockStorage.putData[0], &msg))
+	assert.Equal(t, "order #2", string(msg.Body))
+	assert.Equal(t, 0, acknowledgers[0].acked)
+	assert.Equal(t, 0, acknowledgers[1].acked)
+	assert.Equal(t, 1, acknowledgers[2].acked)
+}
+
+type mockMonitoredStorage struct {
+	mockStorage
+
+	pingResult error
+	lenResult  int
+}
+
+func (s *mockMonitoredStorage) Ping() error {
+	return s.pingResult
+}
+
+func (s *mockMonitoredStorage) Len() (int, error) {
+	return s.lenResult, nil
+}
+
+func TestBridgeWorker_CacheHealth(t *testing.T) {
+	worker := newLimitedBridgeWorker(t, 3, config.BackpressureNack, "noop://")
+
+	cacheMessages(worker, generateTopicMessages(1, "orders"))
+	cacheMessages(worker, generateTopicMessages(1, "payments"))
+	component := worker.CacheHealth()
+	assert.Equal(t, health.StatusUp, component.Status)
+	assert.Equal(t, 2, component.Details["messages"])
+	assert.Equal(t, map[string]int{"orders": 1, "payments": 1}, component.Details["buffers"])
+
+	cacheMessages(worker, generateTopicMessages(1, "orders"))
+	component = worker.CacheHealth()
+	assert.Equal(t, health.StatusDegraded, component.Status)
+	assert.Equal(t, errSaturated.Error(), component.Error)
+}
+
+func TestBridgeWorker_StorageHealth(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+
+	// storage that can not report its state
+	assert.Equal(t, health.StatusUp, worker.StorageHealth().Status)
+
+	monitoredStorage := &mockMonitoredStorage{mockStorage: mockStorage{t: t}, lenResult: 42}
+	worker.storage = monitoredStorage
+	component := worker.StorageHealth()
+	assert.Equal(t, health.StatusUp, component.Status)
+	assert.Equal(t, map[string]interface{}{"backlog": 42}, component.Details)
+
+	monitoredStorage.pingResult = errors.New("connection refused")
+	component = worker.StorageHealth()
+	assert.Equal(t, health.StatusDegraded, component.Status)
+	assert.Equal(t, "connection refused", component.Error)
+}
+
+func TestBridgeWorker_Flush(t *testing.T) {
+	worker, _, batchProducer, cancel := startEventsWorker(t, 100, newChanStorage())
+	defer cancel()
+
+	require.NoError(t, worker.MessageHandler([]byte("order #1"), nil, config.Pipe{KafkaTopic: "orders"}, &mockAcknowledger{}))
+	require.NoError(t, worker.MessageHandler([]byte("payment #1"), nil, config.Pipe{KafkaTopic: "payments"}, &mockAcknowledger{}))
+	assert.Equal(t, map[string]BufferState{
+		"orders":   {Messages: 1, Bytes: len("order #1")},
+		"payments": {Messages: 1, Bytes: len("payment #1")},
+	}, worker.Buffers())
+	assertNoBatch(t, batchProducer.batches)
+
+	// buffers are flushed with neither of them full nor timed out
+	worker.Flush()
+	assert.Len(t, receiveBatch(t, batchProducer.batches), 1)
+	assert.Len(t, receiveBatch(t, batchProducer.batches), 1)
+	assert.Equal(t, map[string]BufferState{"orders": {}, "payments": {}}, worker.Buffers())
+
+	// empty buffers are not flushed
+	worker.Flush()
+	assertNoBatch(t, batchProducer.batches)
+}
+
+func TestBridgeWorker_Replay(t *testing.T) {
+	chanStorage := newChanStorage()
+	worker, _, batchProducer, cancel := startEventsWorker(t, 1, chanStorage)
+	defer cancel()
+
+	select {
+	case <-chanStorage.emptyReads:
+	case <-time.After(time.Second):
+		t.Fatal("storage is not read on start")
+	}
+
+	storedMsg, _ := json.Marshal(producer.NewMessage([]byte("stored after start"), "orders"))
+	require.NoError(t, chanStorage.Put(storedMsg))
+	assertNoBatch(t, batchProducer.batches)
+
+	// storage is read without waiting for the storage read timeout
+	worker.Replay()
+	batch := receiveBatch(t, batchProducer.batches)
+	require.Len(t, batch, 1)
+	assert.Equal(t, []byte("stored after start"), batch[0].Body)
+}
+
+// mockRequeueingStorage keeps requeued data separately from the data put to storage
+type mockRequeueingStorage struct {
+	mockStorage
+	requeued [][]byte
+}
+
+func (s *mockRequeueingStorage) Requeue(data []byte) error {
+	s.requeued = append(s.requeued, data)
+	return nil
+}
+
+func TestBridgeWorker_storeMessage_requeue(t *testing.T) {
+	worker := getDefaultBridgeWorker(t)
+	requeueingStorage := &mockRequeueingStorage{mockStorage: mockStorage{t: t, putResult: []error{nil}}}
+	worker.storage = requeueingStorage
+
+	messages := generateRandomMessages(2)
+	messages[1].Replayed = true
+	for _, msg := range messages {
+		require.NoError(t, worker.storeMessage(msg))
+	}
+
+	// replayed message is put back to the read end, new one is stored as usual
+	stored, _ := json.Marshal(messages[0])
+	requeued, _ := json.Marshal(messages[1])
+	assert.Equal(t, [][]byte{stored}, requeueingStorage.putData)
+	assert.Equal(t, [][]byte{requeued}, requeueingStorage.requeued)
+}
@@ -0,0 +1,90 @@
+package workers
+
+import (
+	"time"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/producer"
+)
+
+// Buffer flush reasons
+const (
+	flushReasonSize    = "size"
+	flushReasonBytes   = "bytes"
+	flushReasonTimeout = "timeout"
+	// flushReasonSaturated is used when worker holds max messages in memory, so all the buffers are flushed
+	flushReasonSaturated = "saturated"
+	// flushReasonForced is used when flush is requested explicitly, e.g. by admin API
+	flushReasonForced = "forced"
+)
+
+// buffer holds messages of a single topic in memory until they are flushed according to buffer settings
+type buffer struct {
+	key      string
+	config   config.BufferConfig
+	messages []*producer.Message
+	bytes    int
+	// since is the time the oldest not flushed message was added at
+	since time.Time
+}
+
+func newBuffer(key string, bufferConfig config.BufferConfig) *buffer {
+	return &buffer{key: key, config: bufferConfig}
+}
+
+// bufferKey returns the name of the buffer message is put to, see config.Pipe.BufferKey
+func bufferKey(msg *producer.Message) string {
+	if msg.Topic == "" {
+		return msg.URL
+	}
+
+	return msg.Topic
+}
+
+func (b *buffer) add(msg *producer.Message, now time.Time) {
+	if len(b.messages) == 0 {
+		b.since = now
+	}
+
+	b.messages = append(b.messages, msg)
+	b.bytes += len(msg.Body)
+}
+
+// full returns true if buffer reached its max size or max bytes
+func (b *buffer) full() bool {
+	if len(b.messages) == 0 {
+		return false
+	}
+
+	return len(b.messages) >= b.config.Size || (b.config.MaxBytes > 0 && b.bytes >= b.config.MaxBytes)
+}
+
+// flushReason returns the reason buffer must be flushed for, empty string is returned if it is not time yet
+func (b *buffer) flushReason(now time.Time) string {
+	switch {
+	case len(b.messages) == 0:
+		return ""
+	case len(b.messages) >= b.config.Size:
+		return flushReasonSize
+	case b.config.MaxBytes > 0 && b.bytes >= b.config.MaxBytes:
+		return flushReasonBytes
+	case now.Sub(b.since) >= b.config.FlushTimeout:
+		return flushReasonTimeout
+	}
+
+	return ""
+}
+
+// flushIn returns time left till buffer flush timeout is over
+func (b *buffer) flushIn(now time.Time) time.Duration {
+	return b.config.FlushTimeout - now.Sub(b.since)
+}
+
+// take removes all the messages from buffer and returns them
+func (b *buffer) take() []*producer.Message {
+	messages := b.messages
+	b.messages = nil
+	b.bytes = 0
+
+	return messages
+}
@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/producer"
+)
+
+func TestBuffer(t *testing.T) {
+	now := time.Now()
+	buf := newBuffer("orders", config.BufferConfig{Size: 3, FlushTimeout: time.Minute, MaxBytes: 10})
+
+	assert.False(t, buf.full())
+	assert.Equal(t, "", buf.flushReason(now.Add(time.Hour)))
+
+	buf.add(producer.NewMessage([]byte("order"), "orders"), now)
+	buf.add(producer.NewMessage([]byte("or"), "orders"), now.Add(time.Second))
+	assert.False(t, buf.full())
+	assert.Equal(t, 7, buf.bytes)
+	assert.Equal(t, 30*time.Second, buf.flushIn(now.Add(30*time.Second)))
+	assert.Equal(t, "", buf.flushReason(now.Add(30*time.Second)))
+	assert.Equal(t, flushReasonTimeout, buf.flushReason(now.Add(time.Minute)))
+
+	buf.add(producer.NewMessage([]byte("order"), "orders"), now)
+	assert.True(t, buf.full())
+	assert.Equal(t, flushReasonSize, buf.flushReason(now))
+
+	messages := buf.take()
+	assert.Len(t, messages, 3)
+	assert.Empty(t, buf.messages)
+	assert.Equal(t, 0, buf.bytes)
+
+	buf.add(producer.NewMessage([]byte("large order"), "orders"), now)
+	assert.True(t, buf.full())
+	assert.Equal(t, flushReasonBytes, buf.flushReason(now))
+}
+
+func TestBufferKey(t *testing.T) {
+	msg := producer.NewMessage(nil, "orders")
+	msg.URL = "http://hooks.local"
+	assert.Equal(t, "orders", bufferKey(msg))
+
+	msg.Topic = ""
+	assert.Equal(t, "http://hooks.local", bufferKey(msg))
+}
@@ -0,0 +1,120 @@
+package workers
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock is a clock that moves only when test advances it
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) timer {
+	return c.newTimer(d, 0)
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) ticker {
+	return fakeTicker{c.newTimer(d, d)}
+}
+
+func (c *fakeClock) newTimer(d, period time.Duration) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1), period: period}
+	t.start(d)
+	c.timers = append(c.timers, t)
+
+	return t
+}
+
+// Advance moves clock forward firing timers and tickers that are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		t.fire()
+	}
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	c        chan time.Time
+	deadline time.Time
+	period   time.Duration
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.active
+	t.start(d)
+
+	return active
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.active
+	t.active = false
+
+	return active
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+func (t *fakeTimer) start(d time.Duration) {
+	t.deadline = t.clock.now.Add(d)
+	t.active = true
+	t.fire()
+}
+
+func (t *fakeTimer) fire() {
+	if !t.active || t.deadline.After(t.clock.now) {
+		return
+	}
+
+	// like time package timers, events are dropped if nobody reads them
+	select {
+	case t.c <- t.clock.now:
+	default:
+	}
+
+	if t.period == 0 {
+		t.active = false
+		return
+	}
+	for !t.deadline.After(t.clock.now) {
+		t.deadline = t.deadline.Add(t.period)
+	}
+}
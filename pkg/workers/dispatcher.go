@@ -0,0 +1,112 @@
+package workers
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/producer"
+)
+
+// Dispatcher routes consumed messages to bridge workers of the Kafka clusters and HTTP destination pipe publishes
+// messages to, every destination has its own worker, so buffering and failures handling are independent per destination
+type Dispatcher struct {
+	workers map[string]*BridgeWorker
+}
+
+// NewDispatcher creates instance of Dispatcher for bridge workers by destination name
+func NewDispatcher(workers map[string]*BridgeWorker) *Dispatcher {
+	return &Dispatcher{workers: workers}
+}
+
+// MessageHandler is a handler function for new messages from AMQP, it passes message to the workers
+// of all pipe destinations. Message is acknowledged only after all the workers acknowledge it,
+// and is rejected as soon as any of them rejects it.
+func (d *Dispatcher) MessageHandler(body []byte, headers map[string]string, pipe config.Pipe, acknowledger producer.Acknowledger) error {
+	destinations := pipe.Destinations()
+	if len(destinations) == 1 {
+		worker, err := d.worker(destinations[0])
+		if err != nil {
+			return err
+		}
+		return worker.MessageHandler(body, headers, pipe, acknowledger)
+	}
+
+	shared := newSharedAcknowledger(acknowledger, len(destinations))
+	for _, destination := range destinations {
+		worker, err := d.worker(destination)
+		if err == nil {
+			err = worker.MessageHandler(body, headers, pipe, shared)
+		}
+		if err != nil {
+			// message that is already handed over to other workers can not be taken back,
+			// so it is rejected as a whole and their acknowledgements are ignored
+			shared.cancel()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) worker(destination string) (*BridgeWorker, error) {
+	worker, ok := d.workers[destination]
+	if !ok {
+		return nil, fmt.Errorf("no bridge worker for destination %q", destination)
+	}
+
+	return worker, nil
+}
+
+// sharedAcknowledger acknowledges message after it is acknowledged given number of times
+// and rejects it on the first rejection, all the subsequent calls are ignored
+type sharedAcknowledger struct {
+	sync.Mutex
+
+	acknowledger producer.Acknowledger
+	pending      int
+	done         bool
+}
+
+func newSharedAcknowledger(acknowledger producer.Acknowledger, count int) *sharedAcknowledger {
+	return &sharedAcknowledger{acknowledger: acknowledger, pending: count}
+}
+
+// Ack acknowledges message when it is acknowledged by all the holders
+func (a *sharedAcknowledger) Ack() error {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.done {
+		return nil
+	}
+
+	a.pending--
+	if a.pending > 0 {
+		return nil
+	}
+
+	a.done = true
+	return a.acknowledger.Ack()
+}
+
+// Nack rejects message right away
+func (a *sharedAcknowledger) Nack(requeue bool) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.done {
+		return nil
+	}
+
+	a.done = true
+	return a.acknowledger.Nack(requeue)
+}
+
+// cancel ignores all the subsequent calls without acknowledging or rejecting message
+func (a *sharedAcknowledger) cancel() {
+	a.Lock()
+	defer a.Unlock()
+
+	a.done = true
+}
@@ -0,0 +1,69 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+)
+
+func TestDispatcher_MessageHandler(t *testing.T) {
+	regionalWorker := getDefaultBridgeWorker(t)
+	analyticsWorker := getDefaultBridgeWorker(t)
+	dispatcher := NewDispatcher(map[string]*BridgeWorker{
+		config.DefaultKafkaCluster: regionalWorker,
+		"analytics":                analyticsWorker,
+	})
+
+	acknowledger := &mockAcknowledger{}
+	err := dispatcher.MessageHandler([]byte("order"), nil, config.Pipe{KafkaTopic: "orders"}, acknowledger)
+	require.NoError(t, err)
+	assert.Len(t, regionalWorker.cachedMessages(), 1)
+	assert.Len(t, analyticsWorker.cachedMessages(), 0)
+	assert.Equal(t, 1, acknowledger.acked)
+
+	acknowledger = &mockAcknowledger{}
+	pipe := config.Pipe{KafkaTopic: "audit", KafkaClusters: []string{config.DefaultKafkaCluster, "analytics"}}
+	err = dispatcher.MessageHandler([]byte("audit"), nil, pipe, acknowledger)
+	require.NoError(t, err)
+	assert.Len(t, regionalWorker.cachedMessages(), 2)
+	require.Len(t, analyticsWorker.cachedMessages(), 1)
+	assert.Equal(t, "audit", analyticsWorker.cachedMessages()[0].Topic)
+	assert.Equal(t, 1, acknowledger.acked)
+
+	// message is rejected by AMQP handler, acknowledgement by the worker that already cached it is ignored
+	acknowledger = &mockAcknowledger{}
+	pipe = config.Pipe{KafkaTopic: "audit", KafkaClusters: []string{"analytics", "unknown"}}
+	err = dispatcher.MessageHandler([]byte("audit"), nil, pipe, acknowledger)
+	assert.Error(t, err)
+	assert.Len(t, analyticsWorker.cachedMessages(), 2)
+	assert.Equal(t, 0, acknowledger.acked)
+	assert.Equal(t, 0, acknowledger.nacked)
+
+	err = dispatcher.MessageHandler([]byte("audit"), nil, config.Pipe{KafkaClusters: []string{"unknown"}}, acknowledger)
+	assert.Error(t, err)
+}
+
+func TestSharedAcknowledger(t *testing.T) {
+	acknowledger := &mockAcknowledger{}
+	shared := newSharedAcknowledger(acknowledger, 2)
+
+	require.NoError(t, shared.Ack())
+	assert.Equal(t, 0, acknowledger.acked)
+	require.NoError(t, shared.Ack())
+	assert.Equal(t, 1, acknowledger.acked)
+	require.NoError(t, shared.Nack(true))
+	assert.Equal(t, 0, acknowledger.nacked)
+
+	acknowledger = &mockAcknowledger{}
+	shared = newSharedAcknowledger(acknowledger, 2)
+
+	require.NoError(t, shared.Nack(true))
+	require.NoError(t, shared.Ack())
+	require.NoError(t, shared.Nack(false))
+	assert.Equal(t, 0, acknowledger.acked)
+	assert.Equal(t, 1, acknowledger.nacked)
+	assert.Equal(t, 1, acknowledger.requeued)
+}
@@ -0,0 +1,81 @@
+package workers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/producer"
+)
+
+// messageKey extracts Kafka message key from AMQP message according to pipe key source,
+// nil is returned if pipe has no key source
+func messageKey(pipe config.Pipe, body []byte, headers map[string]string) ([]byte, error) {
+	switch {
+	case pipe.KafkaKey == "":
+		return nil, nil
+	case pipe.KafkaKey == config.KafkaKeyRoutingKey:
+		return headerKey(headers, producer.HeaderRoutingKey)
+	case pipe.KafkaKey == config.KafkaKeyMessageID:
+		return headerKey(headers, producer.HeaderMessageID)
+	case strings.HasPrefix(pipe.KafkaKey, config.KafkaKeyHeaderPrefix):
+		return headerKey(headers, strings.TrimPrefix(pipe.KafkaKey, config.KafkaKeyHeaderPrefix))
+	case strings.HasPrefix(pipe.KafkaKey, config.KafkaKeyJSONPrefix):
+		return jsonKey(body, strings.TrimPrefix(pipe.KafkaKey, config.KafkaKeyJSONPrefix))
+	}
+
+	return nil, fmt.Errorf("unknown kafka key source %q", pipe.KafkaKey)
+}
+
+func headerKey(headers map[string]string, name string) ([]byte, error) {
+	value, ok := headers[name]
+	if !ok || value == "" {
+		return nil, fmt.Errorf("message has no %q header", name)
+	}
+
+	return []byte(value), nil
+}
+
+// jsonKey walks JSON body by dot-separated path, path elements are object keys or array indexes
+func jsonKey(body []byte, path string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode message body: %w", err)
+	}
+
+	for _, element := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			field, ok := v[element]
+			if !ok {
+				return nil, fmt.Errorf("message body has no %q path", path)
+			}
+			value = field
+		case []interface{}:
+			i, err := strconv.Atoi(element)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("message body has no %q path", path)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("message body has no %q path", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("message body has null value by %q path", path)
+	case string:
+		return []byte(v), nil
+	case json.Number:
+		return []byte(v.String()), nil
+	default:
+		return json.Marshal(v)
+	}
+}
@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hellofresh/kandalf/pkg/config"
+	"github.com/hellofresh/kandalf/pkg/producer"
+)
+
+func TestMessageKey(t *testing.T) {
+	body := []byte(`{"customer": {"id": 42, "uuid": "f81d4fae", "tags": ["new", "vip"], "address": {"country": "DE"}}}`)
+	headers := map[string]string{
+		producer.HeaderRoutingKey: "order.created",
+		producer.HeaderMessageID:  "message-id",
+		"x-customer-id":           "customer-id",
+	}
+
+	cases := map[string]string{
+		"":                         "",
+		"routing-key":              "order.created",
+		"message-id":               "message-id",
+		"header:x-customer-id":     "customer-id",
+		"json:customer.id":         "42",
+		"json:customer.uuid":       "f81d4fae",
+		"json:customer.tags.1":     "vip",
+		"json:customer.address":    `{"country":"DE"}`,
+		"json:customer.tags":       `["new","vip"]`,
+		"json:customer.address.de": "",
+		"header:x-missing":         "",
+		"json:customer.tags.2":     "",
+	}
+
+	for kafkaKey, expected := range cases {
+		key, err := messageKey(config.Pipe{KafkaKey: kafkaKey}, body, headers)
+		if expected == "" {
+			assert.Nil(t, key, kafkaKey)
+			assert.Equal(t, kafkaKey != "", err != nil, kafkaKey)
+			continue
+		}
+
+		assert.NoError(t, err, kafkaKey)
+		assert.Equal(t, expected, string(key), kafkaKey)
+	}
+
+	_, err := messageKey(config.Pipe{KafkaKey: "json:customer.id"}, []byte("i no json"), headers)
+	assert.Error(t, err)
+}